@@ -2,88 +2,479 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/riouske/gophermart/internal/certs"
 	"github.com/riouske/gophermart/internal/config"
 	"github.com/riouske/gophermart/internal/db"
+	"github.com/riouske/gophermart/internal/events"
+	"github.com/riouske/gophermart/internal/handler/gophermart/balance"
+	"github.com/riouske/gophermart/internal/handler/gophermart/health"
 	"github.com/riouske/gophermart/internal/handler/gophermart/order"
 	"github.com/riouske/gophermart/internal/handler/gophermart/user"
+	"github.com/riouske/gophermart/internal/handler/gophermart/webhook"
+	"github.com/riouske/gophermart/internal/handler/gophermart/ws"
 	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/idempotency"
+	"github.com/riouske/gophermart/internal/logger"
+	"github.com/riouske/gophermart/internal/metrics"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi"
+	"github.com/riouske/gophermart/internal/outbox"
+	"github.com/riouske/gophermart/internal/ratelimit"
 	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/router"
 	"github.com/riouske/gophermart/internal/service"
+	"github.com/riouske/gophermart/internal/tracing"
+	"github.com/riouske/gophermart/migrations"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
-	log.Println("Starting gophermart app")
-
 	cfg := config.New()
 
-	database, err := db.NewDB(cfg.DatabaseURI)
+	flag.StringVar(&cfg.Storage, "storage", cfg.Storage, "storage backend: postgres, pgx or memory")
+	flag.BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "apply database migrations on start")
+	flag.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error")
+	flag.StringVar(&cfg.AdminAddress, "admin-address", cfg.AdminAddress, "address of the admin listener serving /metrics, empty to disable")
+	flag.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format: text or json")
+	flag.StringVar(&cfg.TraceExporter, "trace-exporter", cfg.TraceExporter, "trace exporter: none, otlp or stdout")
+	flag.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "TLS certificate file, enables HTTPS with -tls-key")
+	flag.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "TLS private key file")
+	flag.StringVar(&cfg.RateLimitStore, "rate-limit-store", cfg.RateLimitStore, "rate limit store: none, local or postgres")
+	flag.Parse()
+
+	appLogger, err := logger.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(appLogger)
+
+	slog.Info("Starting gophermart app", "storage", cfg.Storage)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TraceExporter,
+		Endpoint:    cfg.TraceEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to configure tracing", err)
+	}
+
+	var (
+		userRepo         *repository.UserRepository
+		orderRepo        *repository.OrderRepository
+		withdrawalRepo   *repository.WithdrawalRepository
+		webhookRepo      *repository.WebhookRepository
+		eventStore       outbox.Store
+		txManager        repository.Transactor
+		readyChecks      []health.Check
+		idempotencyStore idempotency.Store
+		// Buckets shared by every instance, when the storage can hold them
+		sharedRateLimitStore ratelimit.Store
+		// Relays live events between instances sharing the database
+		liveEventRepo *repository.LiveEventRepository
+	)
+
+	switch cfg.Storage {
+	case "postgres":
+		database, err := db.NewDB(cfg.DatabaseURI)
+		if err != nil {
+			fatal("Failed to connect to database", err)
+		}
+		defer database.Close()
+		metrics.RegisterDB(database, "gophermart")
+
+		if cfg.AutoMigrate {
+			if err := migrations.AutoMigrate(context.Background(), database); err != nil {
+				fatal("Failed to migrate database", err)
+			}
+		}
+
+		userRepo = repository.NewUserRepository(database, cfg.QueryTimeout)
+		orderRepo = repository.NewOrderRepository(database, cfg.QueryTimeout)
+		withdrawalRepo = repository.NewWithdrawalRepository(database, cfg.QueryTimeout)
+		webhookRepo = repository.NewWebhookRepository(database, cfg.QueryTimeout)
+		eventStore = repository.NewOutboxRepository(database, cfg.QueryTimeout)
+		txManager = repository.NewTxManager(database, cfg.QueryTimeout)
+		sharedRateLimitStore = repository.NewRateLimitRepository(database, cfg.QueryTimeout)
+		idempotencyStore = repository.NewIdempotencyRepository(database, cfg.QueryTimeout)
+		liveEventRepo = repository.NewLiveEventRepository(database, cfg.DatabaseURI, cfg.QueryTimeout)
+		readyChecks = append(readyChecks,
+			health.Check{Name: "database", Critical: true, Run: database.PingContext},
+			migrationsCheck(database),
+		)
+	case "pgx":
+		pool, err := db.NewPool(context.Background(), cfg.DatabaseURI, db.PoolConfig{
+			MaxConns:           int32(cfg.DBMaxConns),
+			MinConns:           int32(cfg.DBMinConns),
+			StatementCacheSize: cfg.DBStatementCacheSize,
+		})
+		if err != nil {
+			fatal("Failed to connect to database", err)
+		}
+		defer pool.Close()
+		metrics.RegisterPool(pool)
+
+		// Webhooks and live events have no pgx implementation and keep a
+		// small database/sql pool
+		database, err := db.NewDB(cfg.DatabaseURI)
+		if err != nil {
+			fatal("Failed to connect to database", err)
+		}
+		defer database.Close()
+		database.SetMaxOpenConns(2)
+		metrics.RegisterDB(database, "webhooks")
+
+		if cfg.AutoMigrate {
+			if err := migrations.AutoMigrate(context.Background(), database); err != nil {
+				fatal("Failed to migrate database", err)
+			}
+		}
+
+		userRepo = repository.NewPgxUserRepository(pool, cfg.QueryTimeout)
+		orderRepo = repository.NewPgxOrderRepository(pool, cfg.QueryTimeout)
+		withdrawalRepo = repository.NewPgxWithdrawalRepository(pool, cfg.QueryTimeout)
+		webhookRepo = repository.NewWebhookRepository(database, cfg.QueryTimeout)
+		eventStore = repository.NewPgxOutboxRepository(pool, cfg.QueryTimeout)
+		txManager = repository.NewPgxTxManager(pool, cfg.QueryTimeout)
+		sharedRateLimitStore = repository.NewPgxRateLimitRepository(pool, cfg.QueryTimeout)
+		idempotencyStore = repository.NewPgxIdempotencyRepository(pool, cfg.QueryTimeout)
+		liveEventRepo = repository.NewLiveEventRepository(database, cfg.DatabaseURI, cfg.QueryTimeout)
+		readyChecks = append(readyChecks,
+			health.Check{Name: "database", Critical: true, Run: pool.Ping},
+			migrationsCheck(database),
+		)
+	case "memory":
+		// Webhooks need PostgreSQL and stay disabled
+		slog.Warn("Using in-memory storage, data will be lost on exit")
+		store := repository.NewMemoryStore()
+		userRepo = repository.NewMemoryUserRepository(store)
+		orderRepo = repository.NewMemoryOrderRepository(store)
+		withdrawalRepo = repository.NewMemoryWithdrawalRepository(store)
+		eventStore = repository.NewMemoryOutboxRepository(store)
+		txManager = repository.NewMemoryTxManager(store)
+		idempotencyStore = idempotency.NewLocalStore()
+	default:
+		fatal("Unknown storage", fmt.Errorf("storage %q is not supported", cfg.Storage))
+	}
+
+	metrics.RegisterOrderCounts(orderRepo, cfg.QueryTimeout)
+
+	rateLimits, err := ratelimit.ParseLimits(cfg.RateLimits)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Invalid rate limits", err)
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "none":
+	case "local":
+		rateLimitStore = ratelimit.NewLocalStore()
+	case "postgres":
+		if sharedRateLimitStore == nil {
+			fatal("Invalid rate limit store", fmt.Errorf("storage %q cannot share rate limits", cfg.Storage))
+		}
+		rateLimitStore = sharedRateLimitStore
+	default:
+		fatal("Unknown rate limit store", fmt.Errorf("rate limit store %q is not supported", cfg.RateLimitStore))
 	}
-	defer database.Close()
 
-	userRepo := repository.NewUserRepository(database)
-	orderRepo := repository.NewOrderRepository(database)
+	hub := events.NewHub(cfg.WSEventBuffer)
+
 	authService := service.NewAuthService(userRepo, cfg.JWTSecretKey)
+	balanceService := service.NewBalanceService(withdrawalRepo, txManager)
+	orderService := service.NewOrderService(orderRepo, txManager)
+	// A single instance publishes on its own hub; instances sharing the
+	// database relay events so that clients on every one of them see them
+	var broadcaster events.Broadcaster = hub
+	if liveEventRepo != nil {
+		broadcaster = liveEventRepo
+	}
+	liveNotifier := service.NewLiveNotifier(broadcaster, balanceService)
+
+	// Domain events recorded by repositories are fanned out to subscribers
+	eventDispatcher := outbox.NewDispatcher(eventStore, cfg.OutboxPollInterval, cfg.OutboxRetryBase, cfg.OutboxMaxAttempts)
+	eventDispatcher.Subscribe("live", liveNotifier.HandleEvent,
+		model.EventOrderStatusChanged, model.EventOrderProcessed, model.EventWithdrawalMade)
+
+	accrualClient := service.NewAccrualClient(cfg.AccrualSystemAddr)
+	accrualPoller := service.NewAccrualPoller(accrualClient, orderService, cfg.AccrualPollInterval)
+
+	// Orders wait for the accrual system but everything else keeps working
+	readyChecks = append(readyChecks, health.Check{Name: "accrual", Run: accrualClient.Ping})
 
 	// Create handlers
 	registerHandler := user.NewRegisterHandler(authService)
 	loginHandler := user.NewLoginHandler(authService)
 	createOrderHandler := order.NewCreateHandler(orderRepo)
+	batchCreateOrdersHandler := order.NewBatchCreateHandler(orderRepo)
 	listOrdersHandler := order.NewIndexHandler(orderRepo)
+	showBalanceHandler := balance.NewShowHandler(balanceService)
+	withdrawHandler := balance.NewWithdrawHandler(balanceService)
+	listWithdrawalsHandler := balance.NewWithdrawalsHandler(balanceService)
+	socketHandler := ws.NewSocketHandler(hub, ws.Options{PingInterval: cfg.WSPingInterval})
 
 	// Create the auth middleware
 	authMiddleware := middleware.Auth(authService)
 
-	mux := http.NewServeMux()
+	// Retried order uploads and withdrawals replay the first response
+	idempotent := middleware.Idempotency(idempotencyStore, cfg.IdempotencyKeyTTL, cfg.IdempotencyKeyLease, int64(cfg.MaxRequestBodySize))
+
+	bodyLimits, err := middleware.ParseBodyLimits(cfg.BodyLimits)
+	if err != nil {
+		fatal("Invalid body limits", err)
+	}
+	bodyLimitMiddleware := middleware.BodyLimit(bodyLimits, int64(cfg.MaxRequestBodySize))
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
+
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		fatal("Failed to load OpenAPI contract", err)
+	}
+	validateRequests := func(next http.Handler) http.Handler { return next }
+	if cfg.ValidateRequests {
+		validateRequests = middleware.ValidateRequests(validator)
+	}
+	validateResponses := func(next http.Handler) http.Handler { return next }
+	if cfg.ValidateResponses {
+		validateResponses = middleware.ValidateResponses(validator, func(r *http.Request, err error) {
+			slog.ErrorContext(r.Context(), "Response breaks the OpenAPI contract", "error", err)
+		})
+	}
+
+	// Limits apply per route; the probes are left out
+	rateLimitMiddleware := func(next http.Handler) http.Handler { return next }
+	if rateLimitStore != nil {
+		rateLimitMiddleware = middleware.RateLimit(rateLimitStore, rateLimits, trustedProxies)
+	}
+
+	liveHandler := health.NewLiveHandler()
+	readyHandler := health.NewReadyHandler(cfg.ReadinessTimeout, readyChecks...)
+
+	showOrderHandler := order.NewShowHandler(orderRepo)
+
+	routes := router.New()
+
+	// Probes
+	routes.Get("/healthz", liveHandler)
+	routes.Get("/readyz", readyHandler)
+
+	routes.Get("/api/openapi.json", openapi.Handler())
+	api := routes.Group("", validateResponses)
 
 	// Public routes
-	mux.Handle("/api/user/register", registerHandler)
-	mux.Handle("/api/user/login", loginHandler)
+	public := api.Group("/api/user", rateLimitMiddleware, bodyLimitMiddleware, validateRequests)
+	public.Post("/register", registerHandler)
+	public.Post("/login", loginHandler)
 
 	// Protected routes
-	mux.Handle("/api/user/orders", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			createOrderHandler.ServeHTTP(w, r)
-		case http.MethodGet:
-			listOrdersHandler.ServeHTTP(w, r)
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})))
+	protected := api.Group("/api/user", authMiddleware, rateLimitMiddleware, bodyLimitMiddleware, validateRequests)
+	protected.Post("/orders", idempotent(createOrderHandler))
+	protected.Post("/orders/batch", idempotent(batchCreateOrdersHandler))
+	protected.Get("/orders", listOrdersHandler)
+	protected.Get("/orders/{number}", showOrderHandler)
+	protected.Get("/balance", showBalanceHandler)
+	protected.Post("/balance/withdraw", idempotent(withdrawHandler))
+	protected.Get("/withdrawals", listWithdrawalsHandler)
+	protected.Get("/ws", socketHandler)
+
+	pollerCtx, stopPoller := context.WithCancel(context.Background())
+	defer stopPoller()
+
+	if webhookRepo != nil {
+		webhookService := service.NewWebhookService(webhookRepo)
+		eventDispatcher.Subscribe("webhooks", webhookService.HandleEvent,
+			model.EventOrderProcessed, model.EventWithdrawalMade)
+
+		createWebhookHandler := webhook.NewCreateHandler(webhookService)
+		listWebhooksHandler := webhook.NewIndexHandler(webhookService)
+		deleteWebhookHandler := webhook.NewDeleteHandler(webhookService)
+		listDeliveriesHandler := webhook.NewDeliveriesHandler(webhookService)
+		replayDeliveryHandler := webhook.NewReplayHandler(webhookService)
+
+		protected.Post("/webhooks", createWebhookHandler)
+		protected.Get("/webhooks", listWebhooksHandler)
+		protected.Delete("/webhooks/{id}", deleteWebhookHandler)
+		protected.Get("/webhooks/deliveries", listDeliveriesHandler)
+		protected.Post("/webhooks/deliveries/replay", replayDeliveryHandler)
+
+		webhookDispatcher := service.NewWebhookDispatcher(
+			webhookRepo,
+			cfg.WebhookPollInterval,
+			cfg.WebhookRetryBase,
+			cfg.WebhookMaxAttempts,
+		)
+		go webhookDispatcher.Run(pollerCtx)
+	}
+
+	go accrualPoller.Run(pollerCtx)
+	if pruner, ok := rateLimitStore.(ratelimit.Pruner); ok {
+		go ratelimit.RunPruner(pollerCtx, pruner, time.Minute, rateLimits.Longest())
+	}
+	if pruner, ok := idempotencyStore.(idempotency.Pruner); ok {
+		go idempotency.RunPruner(pollerCtx, pruner, time.Minute)
+	}
+	go eventDispatcher.Run(pollerCtx)
+	if liveEventRepo != nil {
+		go liveEventRepo.Listen(pollerCtx, hub)
+	}
+
+	// Outermost last: every request gets an ID first, so that the access
+	// log and a recovered panic are reported with it
+	var handler http.Handler = metrics.Instrument(routes)
+	handler = tracing.Middleware(routes, handler)
+	handler = middleware.Compress(cfg.CompressMinSize, int64(cfg.MaxRequestBodySize))(handler)
+	handler = middleware.Recover(handler)
+	handler = middleware.AccessLog(handler)
+	handler = middleware.RequestID(handler)
 
 	server := &http.Server{
-		Addr:    cfg.ServerAddress,
-		Handler: mux,
+		Addr:              cfg.ServerAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(appLogger.Handler(), slog.LevelError),
+	}
+	server.RegisterOnShutdown(socketHandler.Close)
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		fatal("Invalid TLS configuration", errors.New("both a certificate and a key file are required"))
+	}
+	useTLS := cfg.TLSCertFile != ""
+	if useTLS {
+		reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			fatal("Failed to load TLS certificate", err)
+		}
+		go reloader.Run(pollerCtx, cfg.TLSReloadInterval)
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+
+	switch {
+	case !cfg.HTTP2:
+		// A non-nil empty map keeps net/http from enabling HTTP/2 over TLS
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	case !useTLS:
+		// Without TLS, HTTP/2 is spoken by clients that know the server
+		// supports it, like proxies and gRPC-style clients
+		server.Handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: cfg.IdleTimeout})
 	}
 
 	go func() {
-		log.Printf("Server started on %s", cfg.ServerAddress)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+		slog.Info("Server started", "address", cfg.ServerAddress, "tls", useTLS, "http2", cfg.HTTP2)
+		var err error
+		if useTLS {
+			// The certificate comes from TLSConfig.GetCertificate
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Server failed to start", err)
 		}
 	}()
 
+	// Metrics and the route table are kept off the public listener
+	var adminServer *http.Server
+	if cfg.AdminAddress != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("GET /metrics", metrics.Handler())
+		adminMux.Handle("GET /routes", routes.TableHandler())
+
+		adminServer = &http.Server{
+			Addr:              cfg.AdminAddress,
+			Handler:           adminMux,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ErrorLog:          slog.NewLogLogger(appLogger.Handler(), slog.LevelError),
+		}
+
+		go func() {
+			slog.Info("Admin server started", "address", cfg.AdminAddress)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Admin server failed to start", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shut down the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+
+	// Fail readiness first so load balancers stop sending traffic,
+	// then give them time to notice before closing the listener
+	slog.Info("Draining server", "delay", cfg.ShutdownDrainDelay)
+	readyHandler.Drain()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	slog.Info("Shutting down server")
+	stopPoller()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			fatal("Admin server forced to shutdown", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	slog.Info("Server gracefully stopped")
+}
+
+// migrationsCheck reports the service unready until the schema has caught
+// up with the migrations embedded in this binary
+func migrationsCheck(database *sql.DB) health.Check {
+	latest, err := migrations.LatestVersion()
+	if err != nil {
+		fatal("Failed to read embedded migrations", err)
+	}
+
+	return health.Check{
+		Name:     "migrations",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			return migrations.CheckVersion(ctx, database, latest)
+		},
 	}
+}
 
-	log.Println("Server gracefully stopped")
+// fatal logs the error and exits, like log.Fatal
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
\ No newline at end of file
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/riouske/gophermart/pkg/client"
+)
+
+const usage = `Usage: gophermartctl [flags] <command> [args]
+
+Commands:
+  register LOGIN       create a user and log in; the password is read from
+                       -password, GOPHERMART_PASSWORD or the first line of stdin
+  login LOGIN          log in, caching the token for the server
+  logout               forget the cached token for the server
+  token                print the cached token, for use with other tools
+  upload [FILE]        upload order numbers, one per line, from FILE or stdin
+  orders               list uploaded orders
+  balance              show the points balance
+  withdraw ORDER SUM   spend SUM points on ORDER
+  withdrawals          list withdrawals
+
+Flags:
+`
+
+const defaultServer = "http://localhost:9090"
+
+type options struct {
+	server     string
+	configPath string
+	output     string
+	password   string
+	timeout    time.Duration
+}
+
+func main() {
+	var opts options
+
+	flag.StringVar(&opts.server, "server", os.Getenv("GOPHERMART_URL"), "API base URL (defaults to the last one used, or "+defaultServer+")")
+	flag.StringVar(&opts.configPath, "config", "", "File caching tokens (defaults to gophermart/config.json in the user config directory)")
+	flag.StringVar(&opts.output, "o", "table", "Output format: table or json")
+	flag.StringVar(&opts.password, "password", os.Getenv("GOPHERMART_PASSWORD"), "Password for register and login")
+	flag.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Timeout for each request")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), opts, flag.Arg(0), flag.Args()[1:], os.Stdin, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+func run(ctx context.Context, opts options, command string, args []string, stdin io.Reader, stdout io.Writer) error {
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("unknown output format %q", opts.output)
+	}
+
+	if opts.configPath == "" {
+		path, err := defaultConfigPath()
+		if err != nil {
+			return err
+		}
+		opts.configPath = path
+	}
+	cfg, err := loadConfig(opts.configPath)
+	if err != nil {
+		return err
+	}
+
+	server := opts.server
+	if server == "" {
+		server = cfg.Server
+	}
+	if server == "" {
+		server = defaultServer
+	}
+	server = strings.TrimRight(server, "/")
+
+	c := client.New(server,
+		client.WithToken(cfg.Sessions[server].Token),
+		client.WithHTTPClient(&http.Client{Timeout: opts.timeout}),
+		client.WithRequestCompression(1024))
+	out := newPrinter(stdout, opts.output)
+
+	switch command {
+	case "register", "login":
+		if len(args) == 0 {
+			return fmt.Errorf("%s needs a login", command)
+		}
+		login := args[0]
+		password, err := readPassword(opts.password, stdin)
+		if err != nil {
+			return err
+		}
+
+		if command == "register" {
+			err = c.Register(ctx, login, password)
+		} else {
+			err = c.Login(ctx, login, password)
+		}
+		if err != nil {
+			return err
+		}
+
+		cfg.Server = server
+		cfg.Sessions[server] = session{Login: login, Token: c.Token()}
+		if err := saveConfig(opts.configPath, cfg); err != nil {
+			return err
+		}
+		return out.session(server, login)
+	case "logout":
+		delete(cfg.Sessions, server)
+		return saveConfig(opts.configPath, cfg)
+	case "token":
+		token := cfg.Sessions[server].Token
+		if token == "" {
+			return errNotLoggedIn
+		}
+		fmt.Fprintln(stdout, token)
+		return nil
+	}
+
+	if c.Token() == "" {
+		return errNotLoggedIn
+	}
+	err = runAuthenticated(ctx, c, out, command, args, stdin)
+	if errors.Is(err, client.ErrUnauthorized) {
+		return fmt.Errorf("%w; the token may have expired, log in again", err)
+	}
+	return err
+}
+
+var errNotLoggedIn = errors.New("not logged in, run gophermartctl login LOGIN first")
+
+func runAuthenticated(ctx context.Context, c *client.Client, out *printer, command string, args []string, stdin io.Reader) error {
+	switch command {
+	case "upload":
+		input := stdin
+		if len(args) > 0 && args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			input = file
+		}
+		return upload(ctx, c, out, input)
+	case "orders":
+		orders, err := c.ListOrders(ctx)
+		if err != nil {
+			return err
+		}
+		return out.orders(orders)
+	case "balance":
+		balance, err := c.Balance(ctx)
+		if err != nil {
+			return err
+		}
+		return out.balance(balance)
+	case "withdraw":
+		if len(args) < 2 {
+			return fmt.Errorf("withdraw needs an order number and a sum")
+		}
+		sum, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || sum <= 0 {
+			return fmt.Errorf("invalid sum %q", args[1])
+		}
+		if err := c.Withdraw(ctx, args[0], sum); err != nil {
+			return err
+		}
+		return out.withdrawn(args[0], sum)
+	case "withdrawals":
+		withdrawals, err := c.Withdrawals(ctx)
+		if err != nil {
+			return err
+		}
+		return out.withdrawals(withdrawals)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// upload sends every non-empty line as an order number. Rejected numbers
+// are reported alongside the others and fail the command at the end, so
+// that one bad line does not stop a batch.
+func upload(ctx context.Context, c *client.Client, out *printer, input io.Reader) error {
+	var (
+		results []uploadResult
+		failed  int
+	)
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		number := strings.TrimSpace(scanner.Text())
+		if number == "" {
+			continue
+		}
+
+		result := uploadResult{Number: number}
+		created, err := uploadOrder(ctx, c, number)
+		switch {
+		case err != nil:
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) {
+				// The server is unreachable, no point in going on
+				return err
+			}
+			result.Status, result.Error = "rejected", err.Error()
+			failed++
+		case created:
+			result.Status = "accepted"
+		default:
+			result.Status = "already uploaded"
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read order numbers: %w", err)
+	}
+
+	if err := out.uploads(results); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders were rejected", failed, len(results))
+	}
+	return nil
+}
+
+// uploadRetries bounds how often one number is retried while rate limited
+const uploadRetries = 5
+
+// uploadOrder uploads number, waiting out rate limits as the server asks
+func uploadOrder(ctx context.Context, c *client.Client, number string) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		created, err := c.UploadOrder(ctx, number)
+		var apiErr *client.Error
+		if !errors.Is(err, client.ErrTooManyRequests) || !errors.As(err, &apiErr) || attempt == uploadRetries {
+			return created, err
+		}
+
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func readPassword(password string, stdin io.Reader) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("a password is required")
+	}
+	return password, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "gophermartctl:", err)
+	os.Exit(1)
+}
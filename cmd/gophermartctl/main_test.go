@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/handler/gophermart/balance"
+	"github.com/riouske/gophermart/internal/handler/gophermart/order"
+	"github.com/riouske/gophermart/internal/handler/gophermart/user"
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/router"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+// newServer serves the real handlers on in-memory storage. The first
+// rateLimited uploads are answered with a 429 asking to retry in a second.
+func newServer(t *testing.T, rateLimited int32) *httptest.Server {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	orderRepo := repository.NewMemoryOrderRepository(store)
+	authService := service.NewAuthService(repository.NewMemoryUserRepository(store), "test-secret-key")
+	balanceService := service.NewBalanceService(repository.NewMemoryWithdrawalRepository(store), repository.NewMemoryTxManager(store))
+
+	routes := router.New()
+	public := routes.Group("/api/user")
+	public.Post("/register", user.NewRegisterHandler(authService))
+	public.Post("/login", user.NewLoginHandler(authService))
+
+	protected := routes.Group("/api/user", middleware.Auth(authService))
+	protected.Post("/orders", order.NewCreateHandler(orderRepo))
+	protected.Get("/orders", order.NewIndexHandler(orderRepo))
+	protected.Get("/balance", balance.NewShowHandler(balanceService))
+	protected.Get("/withdrawals", balance.NewWithdrawalsHandler(balanceService))
+
+	var limited atomic.Int32
+	limited.Store(rateLimited)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/user/orders" && limited.Add(-1) >= 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// login registers a user and returns the options of a logged in session
+func login(t *testing.T, server *httptest.Server) options {
+	t.Helper()
+
+	opts := options{
+		server:     server.URL,
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+		output:     "json",
+		timeout:    5 * time.Second,
+	}
+	if err := run(context.Background(), opts, "register", []string{"cli"}, strings.NewReader("secret\n"), &bytes.Buffer{}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	return opts
+}
+
+func TestRun_Login(t *testing.T) {
+	ctx := context.Background()
+	server := newServer(t, 0)
+	opts := login(t, server)
+
+	var stdout bytes.Buffer
+	if err := run(ctx, opts, "login", []string{"cli"}, strings.NewReader("secret\n"), &stdout); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	var session map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &session); err != nil {
+		t.Fatalf("login printed invalid JSON %q: %v", stdout.String(), err)
+	}
+	if session["server"] != server.URL || session["login"] != "cli" {
+		t.Errorf("login printed %v", session)
+	}
+
+	cfg, err := loadConfig(opts.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != server.URL || cfg.Sessions[server.URL].Token == "" {
+		t.Fatalf("expected the token to be cached for %s, got %+v", server.URL, cfg)
+	}
+
+	// Later commands find the server and the token in the config
+	opts.server = ""
+	stdout.Reset()
+	if err := run(ctx, opts, "orders", nil, nil, &stdout); err != nil {
+		t.Fatalf("orders failed: %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "[]" {
+		t.Errorf("orders printed %q, want []", got)
+	}
+
+	stdout.Reset()
+	if err := run(ctx, opts, "token", nil, nil, &stdout); err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != cfg.Sessions[server.URL].Token {
+		t.Errorf("token printed %q, want the cached token", got)
+	}
+
+	if err := run(ctx, opts, "logout", nil, nil, &stdout); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if err := run(ctx, opts, "balance", nil, nil, &stdout); !errors.Is(err, errNotLoggedIn) {
+		t.Errorf("after logout: got %v, want %v", err, errNotLoggedIn)
+	}
+
+	if err := run(ctx, opts, "login", []string{"cli"}, strings.NewReader("wrong\n"), &stdout); err == nil {
+		t.Error("expected login with a wrong password to fail")
+	}
+}
+
+func TestRun_Upload(t *testing.T) {
+	ctx := context.Background()
+	server := newServer(t, 0)
+	opts := login(t, server)
+
+	var stdout bytes.Buffer
+	stdin := strings.NewReader("79927398713\n\n  12345678903  \n79927398713\n1234\n")
+	err := run(ctx, opts, "upload", nil, stdin, &stdout)
+	if err == nil || err.Error() != "1 of 4 orders were rejected" {
+		t.Errorf("got %v, want the rejected order reported", err)
+	}
+
+	var results []uploadResult
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("upload printed invalid JSON %q: %v", stdout.String(), err)
+	}
+	want := []struct{ number, status string }{
+		{"79927398713", "accepted"},
+		{"12345678903", "accepted"},
+		{"79927398713", "already uploaded"},
+		{"1234", "rejected"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for i, result := range results {
+		if result.Number != want[i].number || result.Status != want[i].status {
+			t.Errorf("result %d = %+v, want %s %s", i, result, want[i].number, want[i].status)
+		}
+	}
+	if results[3].Error == "" {
+		t.Error("expected the rejected order to carry the error")
+	}
+
+	stdout.Reset()
+	if err := run(ctx, opts, "orders", nil, nil, &stdout); err != nil {
+		t.Fatalf("orders failed: %v", err)
+	}
+	var orders []map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &orders); err != nil {
+		t.Fatalf("orders printed invalid JSON %q: %v", stdout.String(), err)
+	}
+	if len(orders) != 2 {
+		t.Errorf("got %d orders, want the 2 accepted", len(orders))
+	}
+}
+
+func TestRun_UploadWaitsOutRateLimit(t *testing.T) {
+	server := newServer(t, 1)
+	opts := login(t, server)
+
+	var stdout bytes.Buffer
+	start := time.Now()
+	if err := run(context.Background(), opts, "upload", nil, strings.NewReader("79927398713\n"), &stdout); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", elapsed)
+	}
+
+	var results []uploadResult
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("upload printed invalid JSON %q: %v", stdout.String(), err)
+	}
+	if len(results) != 1 || results[0].Status != "accepted" {
+		t.Errorf("got %+v, want the order accepted after the retry", results)
+	}
+}
+
+func TestRun_InvalidOutput(t *testing.T) {
+	opts := options{configPath: filepath.Join(t.TempDir(), "config.json"), output: "yaml"}
+	if err := run(context.Background(), opts, "orders", nil, nil, &bytes.Buffer{}); err == nil {
+		t.Error("expected an unknown output format to be rejected")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/riouske/gophermart/pkg/client"
+)
+
+type uploadResult struct {
+	Number string `json:"number"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// printer writes command results as aligned tables for people, or as JSON
+// for scripts
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, json: format == "json"}
+}
+
+func (p *printer) session(server, login string) error {
+	if p.json {
+		return p.encode(map[string]string{"server": server, "login": login})
+	}
+	_, err := fmt.Fprintf(p.w, "Logged in to %s as %s\n", server, login)
+	return err
+}
+
+func (p *printer) uploads(results []uploadResult) error {
+	if p.json {
+		return p.encode(nonNil(results))
+	}
+	return p.table([]string{"NUMBER", "STATUS", "ERROR"}, len(results), func(i int) []string {
+		return []string{results[i].Number, results[i].Status, results[i].Error}
+	})
+}
+
+func (p *printer) orders(orders []client.Order) error {
+	if p.json {
+		return p.encode(nonNil(orders))
+	}
+	return p.table([]string{"NUMBER", "STATUS", "ACCRUAL", "UPLOADED"}, len(orders), func(i int) []string {
+		accrual := ""
+		if orders[i].Status == client.OrderStatusProcessed {
+			accrual = formatPoints(orders[i].Accrual)
+		}
+		return []string{orders[i].Number, string(orders[i].Status), accrual, orders[i].UploadedAt.Format(time.RFC3339)}
+	})
+}
+
+func (p *printer) balance(balance *client.Balance) error {
+	if p.json {
+		return p.encode(balance)
+	}
+	return p.table([]string{"CURRENT", "WITHDRAWN"}, 1, func(int) []string {
+		return []string{formatPoints(balance.Current), formatPoints(balance.Withdrawn)}
+	})
+}
+
+func (p *printer) withdrawn(order string, sum float64) error {
+	if p.json {
+		return p.encode(map[string]any{"order": order, "sum": sum})
+	}
+	_, err := fmt.Fprintf(p.w, "Withdrew %s points for order %s\n", formatPoints(sum), order)
+	return err
+}
+
+func (p *printer) withdrawals(withdrawals []client.Withdrawal) error {
+	if p.json {
+		return p.encode(nonNil(withdrawals))
+	}
+	return p.table([]string{"ORDER", "SUM", "PROCESSED"}, len(withdrawals), func(i int) []string {
+		return []string{withdrawals[i].Order, formatPoints(withdrawals[i].Sum), withdrawals[i].ProcessedAt.Format(time.RFC3339)}
+	})
+}
+
+func (p *printer) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table prints a header and n rows; an empty table prints the header only
+func (p *printer) table(header []string, n int, row func(i int) []string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	writeRow(tw, header)
+	for i := 0; i < n; i++ {
+		writeRow(tw, row(i))
+	}
+	return tw.Flush()
+}
+
+func writeRow(w io.Writer, cells []string) {
+	for i, cell := range cells {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, cell)
+	}
+	fmt.Fprintln(w)
+}
+
+func formatPoints(points float64) string {
+	return strconv.FormatFloat(points, 'f', -1, 64)
+}
+
+// nonNil makes empty lists encode as [] rather than null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/riouske/gophermart/internal/db"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/util"
+)
+
+const usage = `Usage: import-orders [flags] [FILE]
+
+Loads orders from a CSV file, or stdin, into the database with COPY. The
+first line is the header user_id,number,status,accrual,uploaded_at; accrual
+and uploaded_at may be empty, and uploaded_at is in RFC 3339. Orders keep
+their status and accrual, and the events announcing them are recorded as if
+the accrual system had processed them. Nothing is imported when any number
+is already taken.
+
+Flags:
+`
+
+// header is the expected first line of the CSV
+var header = []string{"user_id", "number", "status", "accrual", "uploaded_at"}
+
+func main() {
+	var databaseDSN string
+	var timeout time.Duration
+
+	flag.StringVar(&databaseDSN, "database", os.Getenv("DATABASE_URI"), "Database connection string")
+	flag.DurationVar(&timeout, "timeout", 5*time.Minute, "Timeout for the whole import")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if databaseDSN == "" {
+		fatal(errors.New("database connection string is required"))
+	}
+
+	input := io.Reader(os.Stdin)
+	if path := flag.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fatal(err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	ctx := context.Background()
+	pool, err := db.NewPool(ctx, databaseDSN, db.PoolConfig{MaxConns: 1})
+	if err != nil {
+		fatal(err)
+	}
+
+	err = run(ctx, repository.NewPgxOrderRepository(pool, timeout), input, os.Stdout)
+	pool.Close()
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func run(ctx context.Context, orderRepo *repository.OrderRepository, input io.Reader, stdout io.Writer) error {
+	orders, err := readOrders(input)
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return errors.New("no orders to import")
+	}
+
+	count, err := orderRepo.Import(ctx, orders)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Imported %d orders\n", count)
+	return nil
+}
+
+// readOrders parses the whole CSV before anything is imported, so that a
+// bad line is reported with its number instead of failing the COPY
+func readOrders(input io.Reader) ([]*model.Order, error) {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = len(header)
+	reader.TrimLeadingSpace = true
+
+	first, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i, name := range header {
+		if first[i] != name {
+			return nil, fmt.Errorf("header must be %v, got %v", header, first)
+		}
+	}
+
+	var orders []*model.Order
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return orders, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read orders: %w", err)
+		}
+
+		order, err := parseOrder(record)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		orders = append(orders, order)
+	}
+}
+
+func parseOrder(record []string) (*model.Order, error) {
+	order := &model.Order{Number: record[1], Status: model.OrderStatus(record[2])}
+
+	userID, err := strconv.ParseInt(record[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return nil, fmt.Errorf("invalid user_id %q", record[0])
+	}
+	order.UserID = userID
+
+	if !util.ValidateLuhn(order.Number) {
+		return nil, fmt.Errorf("order number %q fails the Luhn check", order.Number)
+	}
+
+	switch order.Status {
+	case model.OrderStatusNew, model.OrderStatusProcessing, model.OrderStatusInvalid, model.OrderStatusProcessed:
+	default:
+		return nil, fmt.Errorf("invalid status %q", record[2])
+	}
+
+	if record[3] != "" {
+		accrual, err := strconv.ParseFloat(record[3], 64)
+		if err != nil || accrual < 0 {
+			return nil, fmt.Errorf("invalid accrual %q", record[3])
+		}
+		order.Accrual = accrual
+	}
+	if order.Accrual > 0 && order.Status != model.OrderStatusProcessed {
+		return nil, fmt.Errorf("only processed orders have an accrual, got %v for a %s order", order.Accrual, order.Status)
+	}
+
+	if record[4] != "" {
+		uploadedAt, err := time.Parse(time.RFC3339, record[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid uploaded_at %q", record[4])
+		}
+		order.UploadedAt = uploadedAt
+	}
+
+	return order, nil
+}
+
+func fatal(err error) {
+	slog.Error("Import error", "error", err)
+	os.Exit(1)
+}
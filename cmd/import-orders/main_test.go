@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	orderRepo := repository.NewMemoryOrderRepository(store)
+
+	user := &model.User{Login: "legacy", Password: "hash"}
+	if err := repository.NewMemoryUserRepository(store).Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	input := "user_id,number,status,accrual,uploaded_at\n" +
+		"1,79927398713,PROCESSED,500,2024-03-01T10:00:00+03:00\n" +
+		"1,12345678903,NEW,,\n"
+	var stdout bytes.Buffer
+	if err := run(ctx, orderRepo, strings.NewReader(input), &stdout); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if stdout.String() != "Imported 2 orders\n" {
+		t.Errorf("run printed %q", stdout.String())
+	}
+
+	order, err := orderRepo.GetByNumber(ctx, "79927398713")
+	if err != nil {
+		t.Fatalf("GetByNumber failed: %v", err)
+	}
+	uploadedAt := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	if order.UserID != user.ID || order.Status != model.OrderStatusProcessed || order.Accrual != 500 || !order.UploadedAt.Equal(uploadedAt) {
+		t.Errorf("imported %+v, want a processed order of user %d with 500 uploaded at %v", order, user.ID, uploadedAt)
+	}
+
+	// Importing a taken number again fails as a whole
+	input = "user_id,number,status,accrual,uploaded_at\n" +
+		"1,49927398716,NEW,,\n" +
+		"1,12345678903,NEW,,\n"
+	if err := run(ctx, orderRepo, strings.NewReader(input), &stdout); err == nil {
+		t.Error("Expected the import of a taken number to fail")
+	}
+	if _, err := orderRepo.GetByNumber(ctx, "49927398716"); err == nil {
+		t.Error("Expected nothing of the failed import to be stored")
+	}
+}
+
+func TestReadOrders_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "Wrong header",
+			input:   "number,user_id,status,accrual,uploaded_at\n",
+			wantErr: "header must be",
+		},
+		{
+			name:    "Missing column",
+			input:   "user_id,number,status,accrual,uploaded_at\n1,79927398713,NEW,\n",
+			wantErr: "wrong number of fields",
+		},
+		{
+			name:    "Invalid user ID",
+			input:   "user_id,number,status,accrual,uploaded_at\nabc,79927398713,NEW,,\n",
+			wantErr: `line 2: invalid user_id "abc"`,
+		},
+		{
+			name:    "Invalid order number",
+			input:   "user_id,number,status,accrual,uploaded_at\n1,79927398713,NEW,,\n1,123456,NEW,,\n",
+			wantErr: `line 3: order number "123456" fails the Luhn check`,
+		},
+		{
+			name:    "Unknown status",
+			input:   "user_id,number,status,accrual,uploaded_at\n1,79927398713,DONE,,\n",
+			wantErr: `invalid status "DONE"`,
+		},
+		{
+			name:    "Accrual of an unprocessed order",
+			input:   "user_id,number,status,accrual,uploaded_at\n1,79927398713,NEW,10,\n",
+			wantErr: "only processed orders have an accrual",
+		},
+		{
+			name:    "Invalid upload time",
+			input:   "user_id,number,status,accrual,uploaded_at\n1,79927398713,NEW,,2024-03-01\n",
+			wantErr: `invalid uploaded_at "2024-03-01"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readOrders(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readOrders error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
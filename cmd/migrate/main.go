@@ -1,27 +1,203 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 
 	"github.com/riouske/gophermart/migrations"
 )
 
+const usage = `Usage: migrate [flags] <command> [args]
+
+Commands:
+  up [N]          apply all pending migrations, or the next N
+  down [N]        roll back the last N migrations (default 1)
+  goto VERSION    migrate up or down to VERSION
+  status          print the applied version and dirty state
+  force VERSION   set VERSION without running migrations, clearing the dirty state
+  create NAME     scaffold numbered up/down files in the -path directory
+
+Flags:
+`
+
 func main() {
 	var databaseDSN string
 	var migrationsPath string
+	var dryRun bool
 
-	flag.StringVar(&databaseDSN, "database", "", "Database connection string")
-	flag.StringVar(&migrationsPath, "path", "./migrations", "Path to migrations directory")
+	flag.StringVar(&databaseDSN, "database", os.Getenv("DATABASE_URI"), "Database connection string")
+	flag.StringVar(&migrationsPath, "path", "", "Path to migrations directory (defaults to the embedded migrations)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print what would be executed without changing anything")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	if command == "create" {
+		if err := create(migrationsPath, args, dryRun); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	if databaseDSN == "" {
-		log.Fatal("Database connection string is required")
+		fatal(errors.New("database connection string is required"))
 	}
 
-	if err := migrations.RunMigrations(databaseDSN, migrationsPath); err != nil {
-		log.Fatalf("Migration error: %v", err)
-		os.Exit(1)
+	m, err := migrations.NewMigrator(databaseDSN, migrationsPath)
+	if err != nil {
+		fatal(err)
 	}
-}
\ No newline at end of file
+
+	err = run(m, command, args, dryRun)
+	if closeErr := m.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func run(m *migrations.Migrator, command string, args []string, dryRun bool) error {
+	switch command {
+	case "up":
+		steps, err := optionalInt(args, 0)
+		if err != nil {
+			return err
+		}
+		// Negative steps would roll back, which is what down is for
+		if steps < 0 {
+			return fmt.Errorf("up needs a non-negative number of steps")
+		}
+		if dryRun {
+			return printPlan(m.PlanUp(steps))
+		}
+		return m.Up(steps)
+	case "down":
+		steps, err := optionalInt(args, 1)
+		if err != nil {
+			return err
+		}
+		if steps < 1 {
+			return fmt.Errorf("down needs a positive number of steps")
+		}
+		if dryRun {
+			return printPlan(m.PlanDown(steps))
+		}
+		return m.Down(steps)
+	case "goto":
+		version, err := requiredInt(args, "goto")
+		if err != nil {
+			return err
+		}
+		if version < 0 {
+			return fmt.Errorf("version must not be negative")
+		}
+		if dryRun {
+			return printPlan(m.PlanGoto(uint(version)))
+		}
+		return m.Goto(uint(version))
+	case "status":
+		version, dirty, err := m.Version()
+		if err != nil {
+			return err
+		}
+		if version < 0 {
+			fmt.Println("No migrations applied")
+			return nil
+		}
+		fmt.Printf("Version: %d\nDirty: %t\n", version, dirty)
+		return nil
+	case "force":
+		version, err := requiredInt(args, "force")
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Printf("Would force version %d\n", version)
+			return nil
+		}
+		return m.Force(version)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func create(migrationsPath string, args []string, dryRun bool) error {
+	if len(args) == 0 {
+		return fmt.Errorf("create needs a migration name")
+	}
+	if migrationsPath == "" {
+		// New files must land next to the embedded ones
+		migrationsPath = "./migrations"
+	}
+
+	name := args[0]
+	for _, arg := range args[1:] {
+		name += " " + arg
+	}
+
+	if dryRun {
+		upPath, downPath, err := migrations.NextFiles(migrationsPath, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would create %s\nWould create %s\n", upPath, downPath)
+		return nil
+	}
+
+	upPath, downPath, err := migrations.Create(migrationsPath, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created %s\nCreated %s\n", upPath, downPath)
+	return nil
+}
+
+func printPlan(steps []migrations.Step, err error) error {
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Println("No migrations to run")
+		return nil
+	}
+
+	for _, step := range steps {
+		fmt.Printf("-- %d %s (%s)\n%s\n\n", step.Version, step.Name, step.Direction, step.SQL)
+	}
+	return nil
+}
+
+func optionalInt(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", args[0])
+	}
+	return value, nil
+}
+
+func requiredInt(args []string, command string) (int, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("%s needs a version", command)
+	}
+	return optionalInt(args, 0)
+}
+
+func fatal(err error) {
+	slog.Error("Migration error", "error", err)
+	os.Exit(1)
+}
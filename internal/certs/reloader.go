@@ -0,0 +1,98 @@
+// Package certs serves a TLS certificate from files that may be replaced
+// while the server runs, as cert-manager and ACME clients do on renewal.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader loads a certificate and key pair and loads it again once either
+// file changes. Plug GetCertificate into a tls.Config to serve the latest one.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	// Modification times of the pair currently served
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// NewReloader loads the pair, failing when it is unreadable or mismatched
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Run checks the files every interval until ctx is cancelled. A pair that
+// fails to load, like one caught halfway through being written, is retried
+// on the next check while the previous certificate stays in use.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.check(); err != nil {
+				slog.WarnContext(ctx, "Failed to reload TLS certificate", "error", err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) check() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return nil
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return err
+	}
+	slog.Info("TLS certificate reloaded", "cert", r.certFile)
+	return nil
+}
+
+func (r *Reloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.certMod, r.keyMod = certMod, keyMod
+	return nil
+}
+
+func (r *Reloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat TLS key: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeKeyPair(t, certFile, keyFile, 1)
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+	first, _ := r.GetCertificate(nil)
+
+	t.Run("Unchanged files are kept", func(t *testing.T) {
+		if err := r.check(); err != nil {
+			t.Fatal(err)
+		}
+		if cert, _ := r.GetCertificate(nil); cert != first {
+			t.Error("Expected the certificate to be kept")
+		}
+	})
+
+	t.Run("Broken files keep the previous certificate", func(t *testing.T) {
+		if err := os.WriteFile(keyFile, []byte("partial"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		touch(t, keyFile, time.Now().Add(time.Minute))
+		if err := r.check(); err == nil {
+			t.Error("Expected a broken key to fail")
+		}
+		if cert, _ := r.GetCertificate(nil); cert != first {
+			t.Error("Expected the previous certificate to stay in use")
+		}
+	})
+
+	t.Run("Replaced files are loaded", func(t *testing.T) {
+		writeKeyPair(t, certFile, keyFile, 2)
+		touch(t, certFile, time.Now().Add(2*time.Minute))
+		touch(t, keyFile, time.Now().Add(2*time.Minute))
+		if err := r.check(); err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := r.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leaf.SerialNumber.Int64() != 2 {
+			t.Errorf("Expected serial 2, got %s", leaf.SerialNumber)
+		}
+	})
+
+	t.Run("Missing files fail", func(t *testing.T) {
+		if _, err := NewReloader(filepath.Join(dir, "missing.crt"), keyFile); err == nil {
+			t.Error("Expected a missing certificate to fail")
+		}
+	})
+}
+
+// writeKeyPair writes a self-signed certificate with the given serial
+func writeKeyPair(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch sets the modification time, as file systems with a coarse clock
+// may not tell quick successive writes apart
+func touch(t *testing.T, name string, mod time.Time) {
+	t.Helper()
+	if err := os.Chtimes(name, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,19 +2,28 @@ package db
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v4/stdlib" // PostgreSQL driver
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 func NewDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+	// Every statement gets a span under the caller's trace
+	db, err := otelsql.Open("pgx", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
-		log.Printf("Failed to ping database: %v", err)
+		slog.Error("Failed to ping database", "error", err)
 		return nil, err
 	}
 
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Type identifies the kind of event pushed to subscribers
+type Type string
+
+const (
+	TypeOrderStatus    Type = "order.status"
+	TypeBalanceChanged Type = "balance.changed"
+)
+
+// Event is a notification addressed to a single user
+type Event struct {
+	Type   Type        `json:"type"`
+	UserID int64       `json:"-"`
+	Data   interface{} `json:"data"`
+}
+
+// Broadcaster publishes an event to the hubs of every instance of the
+// service, so that it reaches the user wherever they are connected
+type Broadcaster interface {
+	Broadcast(ctx context.Context, event Event) error
+}
+
+// Subscription receives events published for one user.
+// Events are delivered on C until the subscription is closed, either by
+// the subscriber or by the hub when the subscriber falls behind.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID int64
+	hub    *Hub
+	once   sync.Once
+	done   chan struct{}
+}
+
+// Done is closed when the subscription stops receiving events
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close unregisters the subscription from the hub
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub fans out events to the subscriptions of the addressed user
+type Hub struct {
+	mu         sync.RWMutex
+	subs       map[int64]map[*Subscription]struct{}
+	bufferSize int
+}
+
+// NewHub creates a hub whose subscriptions buffer up to bufferSize events.
+// A subscriber whose buffer is full is dropped instead of blocking publishers.
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Hub{
+		subs:       make(map[int64]map[*Subscription]struct{}),
+		bufferSize: bufferSize,
+	}
+}
+
+// Subscribe registers a new subscription for the given user
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	ch := make(chan Event, h.bufferSize)
+	sub := &Subscription{
+		C:      ch,
+		ch:     ch,
+		userID: userID,
+		hub:    h,
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+
+	return sub
+}
+
+// Publish delivers the event to every subscription of its user
+func (h *Hub) Publish(event Event) {
+	var slow []*Subscription
+
+	h.mu.RLock()
+	for sub := range h.subs[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+}
+
+// Broadcast publishes the event on this hub only. It is the Broadcaster of
+// a single instance, whose hub holds every connected client.
+func (h *Hub) Broadcast(_ context.Context, event Event) error {
+	h.Publish(event)
+	return nil
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	sub.once.Do(func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[sub.userID], sub)
+		if len(h.subs[sub.userID]) == 0 {
+			delete(h.subs, sub.userID)
+		}
+		close(sub.done)
+	})
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestHub_PublishToUser(t *testing.T) {
+	hub := NewHub(4)
+
+	first := hub.Subscribe(1)
+	second := hub.Subscribe(1)
+	other := hub.Subscribe(2)
+	defer first.Close()
+	defer second.Close()
+	defer other.Close()
+
+	hub.Publish(Event{Type: TypeOrderStatus, UserID: 1})
+
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case event := <-sub.C:
+			if event.Type != TypeOrderStatus {
+				t.Errorf("unexpected event type: %s", event.Type)
+			}
+		default:
+			t.Error("expected event for subscribed user")
+		}
+	}
+
+	select {
+	case <-other.C:
+		t.Error("event delivered to another user")
+	default:
+	}
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	hub := NewHub(1)
+	sub := hub.Subscribe(1)
+
+	hub.Publish(Event{Type: TypeOrderStatus, UserID: 1})
+	hub.Publish(Event{Type: TypeOrderStatus, UserID: 1})
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("expected slow subscriber to be dropped")
+	}
+
+	// Closing an already dropped subscription is a no-op
+	sub.Close()
+
+	hub.Publish(Event{Type: TypeOrderStatus, UserID: 1})
+	if len(sub.C) != 1 {
+		t.Errorf("expected only the buffered event, got %d", len(sub.C))
+	}
+}
@@ -1 +1,44 @@
 package balance
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+type ShowHandler struct {
+	balanceService *service.BalanceService
+}
+
+func NewShowHandler(balanceService *service.BalanceService) *ShowHandler {
+	return &ShowHandler{
+		balanceService: balanceService,
+	}
+}
+
+func (h *ShowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	balance, err := h.balanceService.GetBalance(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get balance", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(balance); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode balance", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
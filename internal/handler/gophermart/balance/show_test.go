@@ -0,0 +1,55 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+func TestShowHandler_ServeHTTP(t *testing.T) {
+	mockImpl := &MockWithdrawalRepository{
+		current:     500.5,
+		withdrawals: make(map[string]*model.Withdrawal),
+	}
+	withdrawalRepo := &repository.WithdrawalRepository{Impl: mockImpl}
+	balanceService := service.NewBalanceService(withdrawalRepo, &MockTransactor{})
+	handler := openapitest.Handler(t, "GET /api/user/balance", NewShowHandler(balanceService))
+
+	t.Run("Balance of the user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+		req = req.WithContext(middleware.WithUserID(context.Background(), 1))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var balance model.Balance
+		if err := json.NewDecoder(rr.Body).Decode(&balance); err != nil {
+			t.Fatalf("failed to decode balance: %v", err)
+		}
+		if balance.Current != 500.5 {
+			t.Errorf("handler returned wrong balance: got %v want 500.5", balance.Current)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+		}
+	})
+}
@@ -1 +1,70 @@
 package balance
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+	"github.com/riouske/gophermart/internal/util"
+)
+
+// WithdrawRequest is a data transfer object for withdrawal requests
+type WithdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+type WithdrawHandler struct {
+	balanceService *service.BalanceService
+}
+
+func NewWithdrawHandler(balanceService *service.BalanceService) *WithdrawHandler {
+	return &WithdrawHandler{
+		balanceService: balanceService,
+	}
+}
+
+func (h *WithdrawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	var request WithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.InvalidBody(w, r, err)
+		return
+	}
+
+	if request.Order == "" || request.Sum <= 0 {
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "Order number and a positive sum are required")
+		return
+	}
+
+	// Validate the order number using Luhn algorithm
+	if !util.ValidateLuhn(request.Order) {
+		problem.Respond(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "Order number fails the Luhn check")
+		return
+	}
+
+	_, err := h.balanceService.Withdraw(r.Context(), userID, request.Order, request.Sum)
+	if err != nil {
+		// Points were already spent towards this order when the withdrawal exists
+		if errors.Is(err, service.ErrInsufficientFunds) || errors.Is(err, repository.ErrWithdrawalExists) {
+			problem.Error(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to withdraw points", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
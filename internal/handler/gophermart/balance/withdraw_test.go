@@ -0,0 +1,151 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+// MockWithdrawalRepository is a test mock for WithdrawalRepository
+type MockWithdrawalRepository struct {
+	current     float64
+	withdrawals map[string]*model.Withdrawal
+}
+
+func (m *MockWithdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
+	if _, ok := m.withdrawals[withdrawal.OrderNumber]; ok {
+		return repository.ErrWithdrawalExists
+	}
+	if m.current < withdrawal.Sum {
+		return repository.ErrInsufficientFunds
+	}
+	m.current -= withdrawal.Sum
+	m.withdrawals[withdrawal.OrderNumber] = withdrawal
+	return nil
+}
+
+func (m *MockWithdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	var result []*model.Withdrawal
+	for _, withdrawal := range m.withdrawals {
+		if withdrawal.UserID == userID {
+			result = append(result, withdrawal)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockWithdrawalRepository) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	return &model.Balance{Current: m.current}, nil
+}
+
+// MockTransactor runs units of work directly against the mock repositories
+type MockTransactor struct {
+	repos *repository.Repositories
+}
+
+func (m *MockTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context, repos *repository.Repositories) error) error {
+	return fn(ctx, m.repos)
+}
+
+func TestWithdrawHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		current    float64
+		existing   map[string]*model.Withdrawal
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Successful withdrawal",
+			body:       `{"order": "2377225624", "sum": 751}`,
+			current:    1000,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Insufficient funds",
+			body:       `{"order": "2377225624", "sum": 751}`,
+			current:    100,
+			wantStatus: http.StatusPaymentRequired,
+			wantCode:   problem.CodeInsufficientFunds,
+		},
+		{
+			name:       "Invalid order number",
+			body:       `{"order": "123456", "sum": 10}`,
+			current:    1000,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidOrderNumber,
+		},
+		{
+			name:    "Order already used for withdrawal",
+			body:    `{"order": "2377225624", "sum": 10}`,
+			current: 1000,
+			existing: map[string]*model.Withdrawal{
+				"2377225624": {UserID: 1, OrderNumber: "2377225624", Sum: 5},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeWithdrawalExists,
+		},
+		{
+			name:       "Non-positive sum",
+			body:       `{"order": "2377225624", "sum": 0}`,
+			current:    1000,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   problem.CodeMalformedBody,
+		},
+		{
+			name:       "Invalid JSON",
+			body:       `{"order": "2377225624"`,
+			current:    1000,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   problem.CodeInvalidJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockImpl := &MockWithdrawalRepository{
+				current:     tt.current,
+				withdrawals: make(map[string]*model.Withdrawal),
+			}
+			if tt.existing != nil {
+				mockImpl.withdrawals = tt.existing
+			}
+
+			withdrawalRepo := &repository.WithdrawalRepository{Impl: mockImpl}
+			tx := &MockTransactor{repos: &repository.Repositories{Withdrawals: withdrawalRepo}}
+			balanceService := service.NewBalanceService(withdrawalRepo, tx)
+			handler := openapitest.Handler(t, "POST /api/user/balance/withdraw", NewWithdrawHandler(balanceService))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithUserID(context.Background(), 1))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantCode != "" {
+				var p problem.Problem
+				if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+					t.Fatalf("failed to decode problem: %v", err)
+				}
+				if p.Code != tt.wantCode {
+					t.Errorf("handler returned wrong error code: got %v want %v", p.Code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -1 +1,66 @@
 package balance
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+// WithdrawalResponse is a data transfer object for withdrawal list response
+type WithdrawalResponse struct {
+	Order       string  `json:"order"`
+	Sum         float64 `json:"sum"`
+	ProcessedAt string  `json:"processed_at"`
+}
+
+type WithdrawalsHandler struct {
+	balanceService *service.BalanceService
+}
+
+func NewWithdrawalsHandler(balanceService *service.BalanceService) *WithdrawalsHandler {
+	return &WithdrawalsHandler{
+		balanceService: balanceService,
+	}
+}
+
+func (h *WithdrawalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	withdrawals, err := h.balanceService.GetWithdrawals(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get withdrawals", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// Return 204 if user has not withdrawn anything yet
+	if len(withdrawals) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var response []WithdrawalResponse
+	for _, withdrawal := range withdrawals {
+		response = append(response, WithdrawalResponse{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt.Format("2006-01-02T15:04:05-07:00"), // RFC3339 format
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode withdrawals", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+func TestWithdrawalsHandler_ServeHTTP(t *testing.T) {
+	processedAt := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		userID      int64
+		withdrawals map[string]*model.Withdrawal
+		wantStatus  int
+		wantOrders  []string
+	}{
+		{
+			name:   "User with withdrawals",
+			userID: 1,
+			withdrawals: map[string]*model.Withdrawal{
+				"2377225624":  {UserID: 1, OrderNumber: "2377225624", Sum: 500, ProcessedAt: processedAt},
+				"12345678903": {UserID: 2, OrderNumber: "12345678903", Sum: 10, ProcessedAt: processedAt},
+			},
+			wantStatus: http.StatusOK,
+			wantOrders: []string{"2377225624"},
+		},
+		{
+			name:   "User without withdrawals",
+			userID: 1,
+			withdrawals: map[string]*model.Withdrawal{
+				"12345678903": {UserID: 2, OrderNumber: "12345678903", Sum: 10, ProcessedAt: processedAt},
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Unauthorized",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockImpl := &MockWithdrawalRepository{withdrawals: tt.withdrawals}
+			withdrawalRepo := &repository.WithdrawalRepository{Impl: mockImpl}
+			balanceService := service.NewBalanceService(withdrawalRepo, &MockTransactor{})
+			handler := openapitest.Handler(t, "GET /api/user/withdrawals", NewWithdrawalsHandler(balanceService))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/withdrawals", nil)
+			if tt.userID != 0 {
+				req = req.WithContext(middleware.WithUserID(context.Background(), tt.userID))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response []WithdrawalResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode withdrawals: %v", err)
+			}
+			if len(response) != len(tt.wantOrders) {
+				t.Fatalf("handler returned %d withdrawals, want %d", len(response), len(tt.wantOrders))
+			}
+			for i, withdrawal := range response {
+				if withdrawal.Order != tt.wantOrders[i] {
+					t.Errorf("withdrawal %d is for order %s, want %s", i, withdrawal.Order, tt.wantOrders[i])
+				}
+				if withdrawal.ProcessedAt != "2026-10-18T12:30:00+00:00" {
+					t.Errorf("withdrawal %d processed_at = %s, want RFC 3339", i, withdrawal.ProcessedAt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package health
+
+import (
+	"net/http"
+)
+
+// LiveHandler answers /healthz. It only tells that the process is up and
+// serving, dependencies are checked by ReadyHandler.
+type LiveHandler struct{}
+
+func NewLiveHandler() *LiveHandler {
+	return &LiveHandler{}
+}
+
+func (h *LiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness states reported by ReadyHandler
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Check is one dependency probed on every readiness request
+type Check struct {
+	Name string
+	// Critical checks make the service unready when they fail,
+	// the others only report it as degraded
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one check in the readiness response
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadyResponse is the body of /readyz
+type ReadyResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// ReadyHandler answers /readyz. It runs every check in parallel within the
+// timeout and replies 503 when a critical one fails or shutdown has begun.
+type ReadyHandler struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewReadyHandler(timeout time.Duration, checks ...Check) *ReadyHandler {
+	return &ReadyHandler{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Drain makes the service report unready from now on, so load balancers
+// stop routing new requests to it before the server shuts down
+func (h *ReadyHandler) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := &ReadyResponse{Status: StatusUnavailable}
+	if !h.draining.Load() {
+		response = h.run(r.Context())
+	}
+
+	status := http.StatusOK
+	if response.Status == StatusUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode readiness", "error", err)
+	}
+}
+
+func (h *ReadyHandler) run(ctx context.Context) *ReadyResponse {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	results := make([]error, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check.Run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	response := &ReadyResponse{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(h.checks)),
+	}
+	for i, check := range h.checks {
+		err := results[i]
+		if err == nil {
+			response.Checks[check.Name] = CheckResult{Status: StatusOK}
+			continue
+		}
+
+		slog.WarnContext(ctx, "Readiness check failed", "check", check.Name, "error", err)
+		if check.Critical {
+			response.Checks[check.Name] = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			response.Status = StatusUnavailable
+		} else {
+			response.Checks[check.Name] = CheckResult{Status: StatusDegraded, Error: err.Error()}
+			if response.Status == StatusOK {
+				response.Status = StatusDegraded
+			}
+		}
+	}
+
+	return response
+}
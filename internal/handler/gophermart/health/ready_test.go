@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func passing(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+func blocking(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReadyHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		checks         []Check
+		drain          bool
+		expectedCode   int
+		expectedStatus string
+	}{
+		{
+			name: "All checks pass",
+			checks: []Check{
+				{Name: "database", Critical: true, Run: passing},
+				{Name: "accrual", Run: passing},
+			},
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusOK,
+		},
+		{
+			name: "Non-critical check fails",
+			checks: []Check{
+				{Name: "database", Critical: true, Run: passing},
+				{Name: "accrual", Run: failing},
+			},
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusDegraded,
+		},
+		{
+			name: "Critical check fails",
+			checks: []Check{
+				{Name: "database", Critical: true, Run: failing},
+				{Name: "accrual", Run: failing},
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusUnavailable,
+		},
+		{
+			name: "Critical check times out",
+			checks: []Check{
+				{Name: "database", Critical: true, Run: blocking},
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusUnavailable,
+		},
+		{
+			name: "Draining",
+			checks: []Check{
+				{Name: "database", Critical: true, Run: passing},
+			},
+			drain:          true,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewReadyHandler(50*time.Millisecond, tt.checks...)
+			if tt.drain {
+				handler.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			var response ReadyResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Status != tt.expectedStatus {
+				t.Errorf("Expected status %q, got %q", tt.expectedStatus, response.Status)
+			}
+		})
+	}
+}
+
+func TestLiveHandler_ServeHTTP(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewLiveHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+}
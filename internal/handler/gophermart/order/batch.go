@@ -0,0 +1,105 @@
+package order
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/util"
+)
+
+// maxBatchOrders bounds the order numbers of one bulk upload
+const maxBatchOrders = 1000
+
+// BatchResponse is the outcome of a bulk upload
+type BatchResponse struct {
+	// Accepted are the numbers uploaded for processing
+	Accepted []string `json:"accepted"`
+	// Skipped are the numbers already uploaded, by this user or another one
+	Skipped []string `json:"skipped"`
+}
+
+// BatchCreateHandler uploads many order numbers, one per line, in one request
+type BatchCreateHandler struct {
+	orderRepo *repository.OrderRepository
+}
+
+func NewBatchCreateHandler(orderRepo *repository.OrderRepository) *BatchCreateHandler {
+	return &BatchCreateHandler{
+		orderRepo: orderRepo,
+	}
+}
+
+func (h *BatchCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.InvalidBody(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	// Every number is checked before any is stored, so a rejected batch
+	// can be fixed and sent again as a whole
+	var orders []*model.Order
+	seen := make(map[string]bool)
+	for _, number := range strings.Fields(string(body)) {
+		if seen[number] {
+			continue
+		}
+		seen[number] = true
+
+		if !util.ValidateLuhn(number) {
+			problem.Respond(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber,
+				"Order number "+number+" fails the Luhn check")
+			return
+		}
+		orders = append(orders, &model.Order{UserID: userID, Number: number, Status: model.OrderStatusNew})
+	}
+	if len(orders) == 0 {
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeEmptyOrderNumber, "At least one order number is required")
+		return
+	}
+	if len(orders) > maxBatchOrders {
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeTooManyOrders,
+			"A batch may not exceed "+strconv.Itoa(maxBatchOrders)+" order numbers")
+		return
+	}
+
+	if _, err := h.orderRepo.CreateMany(r.Context(), orders); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create orders", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	resp := BatchResponse{Accepted: []string{}, Skipped: []string{}}
+	for _, order := range orders {
+		if order.ID == 0 {
+			resp.Skipped = append(resp.Skipped, order.Number)
+		} else {
+			resp.Accepted = append(resp.Accepted, order.Number)
+		}
+	}
+
+	status := http.StatusOK
+	if len(resp.Accepted) > 0 {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode batch response", "error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/util"
+)
+
+func TestBatchCreateHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		existingOrders map[string]*model.Order
+		wantStatus     int
+		wantResponse   *BatchResponse
+	}{
+		{
+			name:         "New order numbers",
+			body:         "79927398713\r\n12345678903\n",
+			wantStatus:   http.StatusAccepted,
+			wantResponse: &BatchResponse{Accepted: []string{"79927398713", "12345678903"}, Skipped: []string{}},
+		},
+		{
+			name: "Uploaded numbers are skipped",
+			body: "79927398713\n12345678903\n79927398713",
+			existingOrders: map[string]*model.Order{
+				"12345678903": {UserID: 2, Number: "12345678903"},
+			},
+			wantStatus:   http.StatusAccepted,
+			wantResponse: &BatchResponse{Accepted: []string{"79927398713"}, Skipped: []string{"12345678903"}},
+		},
+		{
+			name: "Every number already uploaded",
+			body: "79927398713",
+			existingOrders: map[string]*model.Order{
+				"79927398713": {UserID: 1, Number: "79927398713"},
+			},
+			wantStatus:   http.StatusOK,
+			wantResponse: &BatchResponse{Accepted: []string{}, Skipped: []string{"79927398713"}},
+		},
+		{
+			name:       "Invalid order number rejects the batch",
+			body:       "79927398713\n123456",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Empty body",
+			body:       " \n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Too many order numbers",
+			body:       manyOrderNumbers(maxBatchOrders + 1),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockImpl := &MockOrderRepository{
+				orders: make(map[string]*model.Order),
+			}
+			if tt.existingOrders != nil {
+				mockImpl.orders = tt.existingOrders
+			}
+			mockRepo := &repository.OrderRepository{
+				Impl: mockImpl,
+			}
+
+			handler := openapitest.Handler(t, "POST /api/user/orders/batch", NewBatchCreateHandler(mockRepo))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithUserID(context.Background(), 1))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantResponse == nil {
+				if len(mockImpl.orders) != len(tt.existingOrders) {
+					t.Errorf("rejected batch stored %d orders", len(mockImpl.orders)-len(tt.existingOrders))
+				}
+				return
+			}
+
+			var resp BatchResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(&resp, tt.wantResponse) {
+				t.Errorf("handler returned %+v, want %+v", resp, *tt.wantResponse)
+			}
+		})
+	}
+}
+
+// manyOrderNumbers returns n distinct valid order numbers, one per line
+func manyOrderNumbers(n int) string {
+	var b strings.Builder
+	for i := 1000000; n > 0; i++ {
+		number := strconv.Itoa(i)
+		if util.ValidateLuhn(number) {
+			b.WriteString(number + "\n")
+			n--
+		}
+	}
+	return b.String()
+}
@@ -3,10 +3,12 @@ package order
 import (
 	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
 	"github.com/riouske/gophermart/internal/model"
 	"github.com/riouske/gophermart/internal/repository"
 	"github.com/riouske/gophermart/internal/util"
@@ -23,35 +25,30 @@ func NewCreateHandler(orderRepo *repository.OrderRepository) *CreateHandler {
 }
 
 func (h *CreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
+		problem.Unauthorized(w, r)
 		return
 	}
 
 	// Read the order number from the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.InvalidBody(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
 	orderNumber := strings.TrimSpace(string(body))
 	if orderNumber == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeEmptyOrderNumber, "Order number is required")
 		return
 	}
 
 	// Validate the order number using Luhn algorithm
 	if !util.ValidateLuhn(orderNumber) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		problem.Respond(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "Order number fails the Luhn check")
 		return
 	}
 
@@ -63,7 +60,7 @@ func (h *CreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Attempt to save the order
-	err = h.orderRepo.Create(order)
+	err = h.orderRepo.Create(r.Context(), order)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrOrderExists):
@@ -71,10 +68,11 @@ func (h *CreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 		case errors.Is(err, repository.ErrOrderExistsForUser):
 			// Order already exists for another user
-			w.WriteHeader(http.StatusConflict)
+			problem.Error(w, r, err)
 		default:
 			// Internal server error
-			w.WriteHeader(http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to create order", "error", err)
+			problem.Internal(w, r)
 		}
 		return
 	}
@@ -6,9 +6,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/riouske/gophermart/internal/handler/middleware"
 	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
 	"github.com/riouske/gophermart/internal/repository"
 )
 
@@ -28,7 +30,7 @@ func NewMockOrderRepository() *repository.OrderRepository {
 	}
 }
 
-func (m *MockOrderRepository) Create(order *model.Order) error {
+func (m *MockOrderRepository) Create(ctx context.Context, order *model.Order) error {
 	if existing, ok := m.orders[order.Number]; ok {
 		if existing.UserID == order.UserID {
 			return repository.ErrOrderExists
@@ -40,7 +42,7 @@ func (m *MockOrderRepository) Create(order *model.Order) error {
 	return nil
 }
 
-func (m *MockOrderRepository) GetByUserID(userID int64) ([]*model.Order, error) {
+func (m *MockOrderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
 	var result []*model.Order
 	for _, order := range m.orders {
 		if order.UserID == userID {
@@ -50,14 +52,14 @@ func (m *MockOrderRepository) GetByUserID(userID int64) ([]*model.Order, error)
 	return result, nil
 }
 
-func (m *MockOrderRepository) GetByNumber(number string) (*model.Order, error) {
+func (m *MockOrderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
 	if order, ok := m.orders[number]; ok {
 		return order, nil
 	}
 	return nil, repository.ErrOrderNotFound
 }
 
-func (m *MockOrderRepository) GetByID(id int64) (*model.Order, error) {
+func (m *MockOrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
 	for _, order := range m.orders {
 		if order.ID == id {
 			return order, nil
@@ -66,11 +68,40 @@ func (m *MockOrderRepository) GetByID(id int64) (*model.Order, error) {
 	return nil, repository.ErrOrderNotFound
 }
 
-func (m *MockOrderRepository) UpdateStatus(id int64, status model.OrderStatus) error {
+func (m *MockOrderRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	created := 0
+	for _, order := range orders {
+		if _, ok := m.orders[order.Number]; ok {
+			continue
+		}
+		order.ID = int64(len(m.orders) + 1)
+		m.orders[order.Number] = order
+		created++
+	}
+	return created, nil
+}
+
+func (m *MockOrderRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockOrderRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	return nil, nil
+}
+
+func (m *MockOrderRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	counts := make(map[model.OrderStatus]int64)
+	for _, order := range m.orders {
+		counts[order.Status]++
+	}
+	return counts, nil
+}
+
+func (m *MockOrderRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
 	return nil
 }
 
-func (m *MockOrderRepository) UpdateAccrual(id int64, accrual float64, status model.OrderStatus) error {
+func (m *MockOrderRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
 	return nil
 }
 
@@ -140,7 +171,7 @@ func TestCreateHandler_ServeHTTP(t *testing.T) {
 				Impl: mockImpl,
 			}
 
-			handler := NewCreateHandler(mockRepo)
+			handler := openapitest.Handler(t, "POST /api/user/orders", NewCreateHandler(mockRepo))
 
 			// Create a request
 			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader(tt.orderNumber))
@@ -2,9 +2,11 @@ package order
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 
 	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
 	"github.com/riouske/gophermart/internal/model"
 	"github.com/riouske/gophermart/internal/repository"
 )
@@ -28,22 +30,18 @@ func NewIndexHandler(orderRepo *repository.OrderRepository) *IndexHandler {
 }
 
 func (h *IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user ID from context
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
+		problem.Unauthorized(w, r)
 		return
 	}
 
 	// Get all orders for the user
-	orders, err := h.orderRepo.GetByUserID(userID)
+	orders, err := h.orderRepo.GetByUserID(r.Context(), userID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to get orders", "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
@@ -56,25 +54,30 @@ func (h *IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Convert to response format
 	var responseOrders []OrderResponse
 	for _, order := range orders {
-		orderResp := OrderResponse{
-			Number:     order.Number,
-			Status:     order.Status,
-			UploadedAt: order.UploadedAt.Format("2006-01-02T15:04:05-07:00"), // RFC3339 format
-		}
-		
-		// Only include accrual if it's not zero
-		if order.Accrual > 0 {
-			accrual := order.Accrual
-			orderResp.Accrual = &accrual
-		}
-		
-		responseOrders = append(responseOrders, orderResp)
+		responseOrders = append(responseOrders, newOrderResponse(order))
 	}
 
 	// Serialize orders to JSON
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(responseOrders); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode orders", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+}
+
+func newOrderResponse(order *model.Order) OrderResponse {
+	orderResp := OrderResponse{
+		Number:     order.Number,
+		Status:     order.Status,
+		UploadedAt: order.UploadedAt.UTC().Format("2006-01-02T15:04:05-07:00"), // RFC3339 format, the same on every server
+	}
+
+	// Only include accrual if it's not zero
+	if order.Accrual > 0 {
+		accrual := order.Accrual
+		orderResp.Accrual = &accrual
+	}
+
+	return orderResp
 }
\ No newline at end of file
@@ -10,6 +10,7 @@ import (
 
 	"github.com/riouske/gophermart/internal/handler/middleware"
 	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
 	"github.com/riouske/gophermart/internal/repository"
 )
 
@@ -18,19 +19,19 @@ type MockOrderListRepository struct {
 	orders []*model.Order
 }
 
-func (m *MockOrderListRepository) Create(order *model.Order) error {
+func (m *MockOrderListRepository) Create(ctx context.Context, order *model.Order) error {
 	return nil
 }
 
-func (m *MockOrderListRepository) GetByID(id int64) (*model.Order, error) {
+func (m *MockOrderListRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
 	return nil, nil
 }
 
-func (m *MockOrderListRepository) GetByNumber(number string) (*model.Order, error) {
+func (m *MockOrderListRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
 	return nil, nil
 }
 
-func (m *MockOrderListRepository) GetByUserID(userID int64) ([]*model.Order, error) {
+func (m *MockOrderListRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
 	var userOrders []*model.Order
 	for _, order := range m.orders {
 		if order.UserID == userID {
@@ -40,11 +41,27 @@ func (m *MockOrderListRepository) GetByUserID(userID int64) ([]*model.Order, err
 	return userOrders, nil
 }
 
-func (m *MockOrderListRepository) UpdateStatus(id int64, status model.OrderStatus) error {
+func (m *MockOrderListRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	return 0, nil
+}
+
+func (m *MockOrderListRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockOrderListRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	return nil, nil
+}
+
+func (m *MockOrderListRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	return nil, nil
+}
+
+func (m *MockOrderListRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
 	return nil
 }
 
-func (m *MockOrderListRepository) UpdateAccrual(id int64, accrual float64, status model.OrderStatus) error {
+func (m *MockOrderListRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
 	return nil
 }
 
@@ -123,7 +140,7 @@ func TestIndexHandler_ServeHTTP(t *testing.T) {
 			}
 
 			// Create the handler with the mock repository
-			handler := NewIndexHandler(mockRepo)
+			handler := openapitest.Handler(t, "GET /api/user/orders", NewIndexHandler(mockRepo))
 
 			// Create a request
 			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
@@ -206,4 +223,18 @@ func TestIndexHandler_ServeHTTP(t *testing.T) {
 			}
 		})
 	}
+}
+
+func TestNewOrderResponse_UploadedAtInUTC(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	order := &model.Order{
+		Number:     "9278923470",
+		Status:     model.OrderStatusNew,
+		UploadedAt: time.Date(2020, 12, 10, 15, 15, 45, 0, moscow),
+	}
+
+	// The offset of the server's zone must not leak into the response
+	if got, want := newOrderResponse(order).UploadedAt, "2020-12-10T12:15:45+00:00"; got != want {
+		t.Errorf("handler returned wrong uploaded_at: got %v want %v", got, want)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,57 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+// ShowHandler returns one order of the user by its number
+type ShowHandler struct {
+	orderRepo *repository.OrderRepository
+}
+
+func NewShowHandler(orderRepo *repository.OrderRepository) *ShowHandler {
+	return &ShowHandler{
+		orderRepo: orderRepo,
+	}
+}
+
+func (h *ShowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	order, err := h.orderRepo.GetByNumber(r.Context(), r.PathValue("number"))
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			problem.Error(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get order", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// Orders of other users are reported as missing, not forbidden,
+	// so their numbers cannot be probed
+	if order.UserID != userID {
+		problem.Error(w, r, repository.ErrOrderNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newOrderResponse(order)); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode order", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -3,8 +3,10 @@ package user
 import (
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/riouske/gophermart/internal/handler/problem"
 	"github.com/riouske/gophermart/internal/model"
 	"github.com/riouske/gophermart/internal/service"
 )
@@ -20,29 +22,25 @@ func NewLoginHandler(authService *service.AuthService) *LoginHandler {
 }
 
 func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
 	var credentials model.UserCredentials
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.InvalidBody(w, r, err)
 		return
 	}
 
 	if credentials.Login == "" || credentials.Password == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeMissingCredentials, "Login and password are required")
 		return
 	}
 
-	_, token, err := h.authService.Login(&credentials)
+	_, token, err := h.authService.Login(r.Context(), &credentials)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
-			w.WriteHeader(http.StatusUnauthorized)
+			problem.Error(w, r, err)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to log in user", "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
@@ -6,16 +6,17 @@ import (
 
 	"github.com/riouske/gophermart/internal/handler/gophermart/user"
 	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/router"
 	"github.com/riouske/gophermart/internal/tests"
 )
 
 func TestLoginHandler(t *testing.T) {
 	// Setup
-	authService, _, db := tests.SetupAuthService(t)
-	defer db.Close()
+	authService, _ := tests.SetupMemoryAuthService(t)
 
-	registerHandler := user.NewRegisterHandler(authService)
-	loginHandler := user.NewLoginHandler(authService)
+	registerHandler := openapitest.Handler(t, "POST /api/user/register", user.NewRegisterHandler(authService))
+	loginHandler := openapitest.Handler(t, "POST /api/user/login", user.NewLoginHandler(authService))
 
 	// Pre-register a user for testing login
 	testUser := model.UserCredentials{
@@ -106,10 +107,17 @@ func TestLoginHandler(t *testing.T) {
 	})
 
 	t.Run("LoginWithInvalidMethod", func(t *testing.T) {
-		rr := tests.MakeRequest(t, http.MethodGet, "/api/user/login", nil, loginHandler)
+		// Methods are enforced by the router
+		routes := router.New()
+		routes.Post("/api/user/login", loginHandler)
+
+		rr := tests.MakeRequest(t, http.MethodGet, "/api/user/login", nil, routes)
 		if status := rr.Code; status != http.StatusMethodNotAllowed {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
 		}
+		if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+			t.Errorf("handler returned wrong Allow header: got %q want %q", allow, http.MethodPost)
+		}
 	})
 
 	t.Run("LoginWithInvalidJSON", func(t *testing.T) {
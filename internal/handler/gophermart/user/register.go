@@ -3,8 +3,10 @@ package user
 import (
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/riouske/gophermart/internal/handler/problem"
 	"github.com/riouske/gophermart/internal/model"
 	"github.com/riouske/gophermart/internal/repository"
 	"github.com/riouske/gophermart/internal/service"
@@ -21,29 +23,25 @@ func NewRegisterHandler(authService *service.AuthService) *RegisterHandler {
 }
 
 func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
 	var credentials model.UserCredentials
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.InvalidBody(w, r, err)
 		return
 	}
 
 	if credentials.Login == "" || credentials.Password == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeMissingCredentials, "Login and password are required")
 		return
 	}
 
-	_, token, err := h.authService.Register(&credentials)
+	_, token, err := h.authService.Register(r.Context(), &credentials)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserExists) {
-			w.WriteHeader(http.StatusConflict)
+			problem.Error(w, r, err)
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to register user", "error", err)
+		problem.Internal(w, r)
 		return
 	}
 
@@ -6,15 +6,16 @@ import (
 
 	"github.com/riouske/gophermart/internal/handler/gophermart/user"
 	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/router"
 	"github.com/riouske/gophermart/internal/tests"
 )
 
 func TestRegisterHandler(t *testing.T) {
 	// Setup
-	authService, _, db := tests.SetupAuthService(t)
-	defer db.Close()
+	authService, _ := tests.SetupMemoryAuthService(t)
 
-	handler := user.NewRegisterHandler(authService)
+	handler := openapitest.Handler(t, "POST /api/user/register", user.NewRegisterHandler(authService))
 
 	t.Run("RegisterValidUser", func(t *testing.T) {
 		credentials := model.UserCredentials{
@@ -93,10 +94,17 @@ func TestRegisterHandler(t *testing.T) {
 	})
 
 	t.Run("RegisterWithInvalidMethod", func(t *testing.T) {
-		rr := tests.MakeRequest(t, http.MethodGet, "/api/user/register", nil, handler)
+		// Methods are enforced by the router
+		routes := router.New()
+		routes.Post("/api/user/register", handler)
+
+		rr := tests.MakeRequest(t, http.MethodGet, "/api/user/register", nil, routes)
 		if status := rr.Code; status != http.StatusMethodNotAllowed {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
 		}
+		if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+			t.Errorf("handler returned wrong Allow header: got %q want %q", allow, http.MethodPost)
+		}
 	})
 
 	t.Run("RegisterWithInvalidJSON", func(t *testing.T) {
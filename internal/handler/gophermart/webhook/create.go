@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+// CreateRequest is a data transfer object for webhook subscription requests
+type CreateRequest struct {
+	URL    string               `json:"url"`
+	Secret string               `json:"secret"`
+	Events []model.WebhookEvent `json:"events"`
+}
+
+type CreateHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewCreateHandler(webhookService *service.WebhookService) *CreateHandler {
+	return &CreateHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *CreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	var request CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.InvalidBody(w, r, err)
+		return
+	}
+
+	webhook, err := h.webhookService.Subscribe(r.Context(), userID, request.URL, request.Secret, request.Events)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWebhookURL) ||
+			errors.Is(err, service.ErrWebhookURLNotAllowed) ||
+			errors.Is(err, service.ErrInvalidWebhookEvent) {
+			problem.Error(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to create webhook", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// The secret is only returned once, on creation
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(webhook)
+}
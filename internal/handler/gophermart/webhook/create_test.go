@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+	"github.com/riouske/gophermart/internal/tests"
+)
+
+// newOfflineService returns a service for requests rejected before they
+// reach the database
+func newOfflineService() *service.WebhookService {
+	return service.NewWebhookService(repository.NewWebhookRepository(nil, tests.TestConfig().QueryTimeout))
+}
+
+// newDBService returns a service over the test database with a user to act as
+func newDBService(t *testing.T) (*service.WebhookService, int64) {
+	t.Helper()
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	t.Cleanup(func() { db.Close() })
+
+	user := &model.User{Login: "webhooks", Password: "hash"}
+	if err := repository.NewUserRepository(db, tests.TestConfig().QueryTimeout).Create(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return service.NewWebhookService(repository.NewWebhookRepository(db, tests.TestConfig().QueryTimeout)), user.ID
+}
+
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	var p problem.Problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	return p
+}
+
+func TestCreateHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		userID     int64
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Loopback URL",
+			body:       `{"url": "http://127.0.0.1:8080/hooks", "events": ["order.processed"]}`,
+			userID:     1,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidWebhookURL,
+		},
+		{
+			name:       "Private network URL",
+			body:       `{"url": "https://10.0.0.7/hooks", "events": ["order.processed"]}`,
+			userID:     1,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidWebhookURL,
+		},
+		{
+			name:       "Cloud metadata URL",
+			body:       `{"url": "http://169.254.169.254/latest/meta-data", "events": ["order.processed"]}`,
+			userID:     1,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidWebhookURL,
+		},
+		{
+			name:       "Not an HTTP URL",
+			body:       `{"url": "ftp://203.0.113.10/hooks", "events": ["order.processed"]}`,
+			userID:     1,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidWebhookURL,
+		},
+		{
+			name:       "Unknown event",
+			body:       `{"url": "https://203.0.113.10/hooks", "events": ["order.created"]}`,
+			userID:     1,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   problem.CodeInvalidWebhookEvent,
+		},
+		{
+			name:       "Invalid JSON",
+			body:       `{"url": "https://203.0.113.10/hooks"`,
+			userID:     1,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   problem.CodeInvalidJSON,
+		},
+		{
+			name:       "Unauthorized",
+			body:       `{"url": "https://203.0.113.10/hooks", "events": ["order.processed"]}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	handler := openapitest.Handler(t, "POST /api/user/webhooks", NewCreateHandler(newOfflineService()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks", strings.NewReader(tt.body))
+			if tt.userID != 0 {
+				req = req.WithContext(middleware.WithUserID(context.Background(), tt.userID))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				if p := decodeProblem(t, rr); p.Code != tt.wantCode {
+					t.Errorf("handler returned wrong error code: got %v want %v", p.Code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateHandler_Created(t *testing.T) {
+	webhookService, userID := newDBService(t)
+	handler := openapitest.Handler(t, "POST /api/user/webhooks", NewCreateHandler(webhookService))
+
+	body := `{"url": "https://203.0.113.10/hooks", "events": ["order.processed", "balance.withdrawn"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks", strings.NewReader(body))
+	req = req.WithContext(middleware.WithUserID(context.Background(), userID))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var webhook model.Webhook
+	if err := json.NewDecoder(rr.Body).Decode(&webhook); err != nil {
+		t.Fatalf("failed to decode webhook: %v", err)
+	}
+	if webhook.ID == 0 || webhook.URL != "https://203.0.113.10/hooks" || len(webhook.Events) != 2 {
+		t.Errorf("unexpected webhook: %+v", webhook)
+	}
+	if webhook.Secret == "" {
+		t.Error("expected a generated secret on creation")
+	}
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+type DeleteHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewDeleteHandler(webhookService *service.WebhookService) *DeleteHandler {
+	return &DeleteHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *DeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeInvalidID, "Webhook ID must be an integer")
+		return
+	}
+
+	if err := h.webhookService.Unsubscribe(r.Context(), userID, webhookID); err != nil {
+		if errors.Is(err, repository.ErrWebhookNotFound) {
+			problem.Error(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to delete webhook", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
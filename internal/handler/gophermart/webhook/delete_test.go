@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+)
+
+func TestDeleteHandler_ServeHTTP(t *testing.T) {
+	handler := openapitest.Handler(t, "DELETE /api/user/webhooks/{id}", NewDeleteHandler(newOfflineService()))
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/abc", nil)
+		req = req.WithContext(middleware.WithUserID(context.Background(), 1))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		if p := decodeProblem(t, rr); p.Code != problem.CodeInvalidID {
+			t.Errorf("handler returned wrong error code: got %v want %v", p.Code, problem.CodeInvalidID)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/1", nil)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestDeleteHandler_Delete(t *testing.T) {
+	webhookService, userID := newDBService(t)
+	handler := openapitest.Handler(t, "DELETE /api/user/webhooks/{id}", NewDeleteHandler(webhookService))
+
+	webhook, err := webhookService.Subscribe(context.Background(), userID, "https://203.0.113.10/hooks", "",
+		[]model.WebhookEvent{model.WebhookEventOrderProcessed})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	deleteWebhook := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/"+strconv.FormatInt(webhook.ID, 10), nil)
+		req = req.WithContext(middleware.WithUserID(context.Background(), userID))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := deleteWebhook(); rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	rr := deleteWebhook()
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("deleting again: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if p := decodeProblem(t, rr); p.Code != problem.CodeWebhookNotFound {
+		t.Errorf("handler returned wrong error code: got %v want %v", p.Code, problem.CodeWebhookNotFound)
+	}
+}
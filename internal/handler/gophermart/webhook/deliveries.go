@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+type DeliveriesHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewDeliveriesHandler(webhookService *service.WebhookService) *DeliveriesHandler {
+	return &DeliveriesHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *DeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get webhook deliveries", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode webhook deliveries", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
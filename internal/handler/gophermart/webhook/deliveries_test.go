@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+)
+
+func TestDeliveriesHandler_ServeHTTP(t *testing.T) {
+	webhookService, userID := newDBService(t)
+	handler := openapitest.Handler(t, "GET /api/user/webhooks/deliveries", NewDeliveriesHandler(webhookService))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks/deliveries", nil)
+	req = req.WithContext(middleware.WithUserID(context.Background(), userID))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+}
+
+func TestDeliveriesHandler_Unauthorized(t *testing.T) {
+	handler := openapitest.Handler(t, "GET /api/user/webhooks/deliveries", NewDeliveriesHandler(newOfflineService()))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/webhooks/deliveries", nil))
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+type IndexHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewIndexHandler(webhookService *service.WebhookService) *IndexHandler {
+	return &IndexHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	webhooks, err := h.webhookService.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get webhooks", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Never echo signing secrets back after creation
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhooks); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode webhooks", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+)
+
+func TestIndexHandler_ServeHTTP(t *testing.T) {
+	webhookService, userID := newDBService(t)
+	handler := openapitest.Handler(t, "GET /api/user/webhooks", NewIndexHandler(webhookService))
+
+	list := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks", nil)
+		req = req.WithContext(middleware.WithUserID(context.Background(), userID))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := list(); rr.Code != http.StatusNoContent {
+		t.Errorf("no webhooks: got status %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	_, err := webhookService.Subscribe(context.Background(), userID, "https://203.0.113.10/hooks", "top-secret",
+		[]model.WebhookEvent{model.WebhookEventOrderProcessed})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	rr := list()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var webhooks []model.Webhook
+	if err := json.NewDecoder(rr.Body).Decode(&webhooks); err != nil {
+		t.Fatalf("failed to decode webhooks: %v", err)
+	}
+	if len(webhooks) != 1 || webhooks[0].URL != "https://203.0.113.10/hooks" {
+		t.Fatalf("unexpected webhooks: %+v", webhooks)
+	}
+	if webhooks[0].Secret != "" {
+		t.Error("signing secret must not be listed")
+	}
+}
+
+func TestIndexHandler_Unauthorized(t *testing.T) {
+	handler := openapitest.Handler(t, "GET /api/user/webhooks", NewIndexHandler(newOfflineService()))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/webhooks", nil))
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+// ReplayRequest is a data transfer object for delivery replay requests
+type ReplayRequest struct {
+	ID int64 `json:"id"`
+}
+
+type ReplayHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewReplayHandler(webhookService *service.WebhookService) *ReplayHandler {
+	return &ReplayHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *ReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	var request ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.InvalidBody(w, r, err)
+		return
+	}
+	if request.ID <= 0 {
+		problem.Respond(w, r, http.StatusBadRequest, problem.CodeInvalidID, "Delivery ID must be positive")
+		return
+	}
+
+	if err := h.webhookService.Replay(r.Context(), userID, request.ID); err != nil {
+		if errors.Is(err, repository.ErrDeliveryNotFound) || errors.Is(err, repository.ErrDeliveryInFlight) {
+			problem.Error(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to replay webhook delivery", "error", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// Delivery is queued and will be picked up by the dispatcher
+	w.WriteHeader(http.StatusAccepted)
+}
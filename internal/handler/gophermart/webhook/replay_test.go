@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/openapi/openapitest"
+)
+
+func TestReplayHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		userID     int64
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Non-positive ID",
+			body:       `{"id": 0}`,
+			userID:     1,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   problem.CodeInvalidID,
+		},
+		{
+			name:       "Invalid JSON",
+			body:       `{"id": `,
+			userID:     1,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   problem.CodeInvalidJSON,
+		},
+		{
+			name:       "Unauthorized",
+			body:       `{"id": 1}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	handler := openapitest.Handler(t, "POST /api/user/webhooks/deliveries/replay", NewReplayHandler(newOfflineService()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks/deliveries/replay", strings.NewReader(tt.body))
+			if tt.userID != 0 {
+				req = req.WithContext(middleware.WithUserID(context.Background(), tt.userID))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				if p := decodeProblem(t, rr); p.Code != tt.wantCode {
+					t.Errorf("handler returned wrong error code: got %v want %v", p.Code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayHandler_NotFound(t *testing.T) {
+	webhookService, userID := newDBService(t)
+	handler := openapitest.Handler(t, "POST /api/user/webhooks/deliveries/replay", NewReplayHandler(webhookService))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks/deliveries/replay", strings.NewReader(`{"id": 42}`))
+	req = req.WithContext(middleware.WithUserID(context.Background(), userID))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+	if p := decodeProblem(t, rr); p.Code != problem.CodeDeliveryNotFound {
+		t.Errorf("handler returned wrong error code: got %v want %v", p.Code, problem.CodeDeliveryNotFound)
+	}
+}
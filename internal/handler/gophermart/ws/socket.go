@@ -0,0 +1,225 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/riouske/gophermart/internal/events"
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+)
+
+// Topics clients can subscribe to
+const (
+	TopicOrders  = "orders"
+	TopicBalance = "balance"
+)
+
+var topicEvents = map[string]events.Type{
+	TopicOrders:  events.TypeOrderStatus,
+	TopicBalance: events.TypeBalanceChanged,
+}
+
+// ClientMessage is a message sent by the client over the socket
+type ClientMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics"`
+}
+
+// ServerMessage is a control message sent to the client
+type ServerMessage struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Options control keepalive and backpressure of a socket connection
+type Options struct {
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxMessageSize int64
+}
+
+type SocketHandler struct {
+	hub      *events.Hub
+	opts     Options
+	upgrader websocket.Upgrader
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSocketHandler(hub *events.Hub, opts Options) *SocketHandler {
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = 30 * time.Second
+	}
+	if opts.PongTimeout <= opts.PingInterval {
+		opts.PongTimeout = opts.PingInterval * 2
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = 4096
+	}
+
+	return &SocketHandler{
+		hub:     hub,
+		opts:    opts,
+		closing: make(chan struct{}),
+	}
+}
+
+// Close tells every open connection that the server is going away. Upgraded
+// connections are hijacked, so http.Server.Shutdown neither waits for nor
+// closes them; register Close with http.Server.RegisterOnShutdown.
+func (h *SocketHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closing) })
+}
+
+func (h *SocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		problem.Unauthorized(w, r)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+	defer conn.Close()
+
+	sub := h.hub.Subscribe(userID)
+	defer sub.Close()
+
+	messages := make(chan ClientMessage)
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	go h.read(conn, messages, readerDone, writerDone)
+
+	h.write(r.Context(), conn, sub, messages, readerDone)
+	close(writerDone)
+}
+
+// read consumes client messages until the connection fails or stops answering pings
+func (h *SocketHandler) read(conn *websocket.Conn, messages chan<- ClientMessage, done chan<- struct{}, writerDone <-chan struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(h.opts.MaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(h.opts.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.opts.PongTimeout))
+	})
+
+	for {
+		var msg ClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			// ReadJSON reports empty and truncated messages as io.ErrUnexpectedEOF,
+			// a dropped connection is a *websocket.CloseError instead
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return
+			}
+			// Malformed messages are answered with an error instead of dropping the connection
+			msg = ClientMessage{}
+		}
+
+		select {
+		case messages <- msg:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// write owns all writes to the connection: events, replies and pings
+func (h *SocketHandler) write(ctx context.Context, conn *websocket.Conn, sub *events.Subscription, messages <-chan ClientMessage, readerDone <-chan struct{}) {
+	ticker := time.NewTicker(h.opts.PingInterval)
+	defer ticker.Stop()
+
+	topics := make(map[events.Type]bool)
+
+	for {
+		select {
+		case event := <-sub.C:
+			if !topics[event.Type] {
+				continue
+			}
+			if err := h.send(ctx, conn, event); err != nil {
+				return
+			}
+		case msg := <-messages:
+			if err := h.send(ctx, conn, h.handle(msg, topics)); err != nil {
+				return
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(h.opts.WriteTimeout)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-sub.Done():
+			// The hub dropped us because the client does not keep up with events
+			deadline := time.Now().Add(h.opts.WriteTimeout)
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"), deadline)
+			return
+		case <-h.closing:
+			deadline := time.Now().Add(h.opts.WriteTimeout)
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), deadline)
+			return
+		case <-readerDone:
+			return
+		}
+	}
+}
+
+// handle applies a client message to the topic set and builds the reply
+func (h *SocketHandler) handle(msg ClientMessage, topics map[events.Type]bool) ServerMessage {
+	if msg.Action != "subscribe" && msg.Action != "unsubscribe" {
+		return ServerMessage{Type: "error", Error: "unknown action"}
+	}
+
+	for _, topic := range msg.Topics {
+		if _, ok := topicEvents[topic]; !ok {
+			return ServerMessage{Type: "error", Error: "unknown topic: " + topic}
+		}
+	}
+
+	for _, topic := range msg.Topics {
+		topics[topicEvents[topic]] = msg.Action == "subscribe"
+	}
+
+	var active []string
+	for topic, eventType := range topicEvents {
+		if topics[eventType] {
+			active = append(active, topic)
+		}
+	}
+	sort.Strings(active)
+
+	return ServerMessage{Type: msg.Action + "d", Topics: active}
+}
+
+func (h *SocketHandler) send(ctx context.Context, conn *websocket.Conn, v interface{}) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+	if err := conn.WriteJSON(v); err != nil {
+		slog.WarnContext(ctx, "Failed to write to websocket", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/riouske/gophermart/internal/events"
+	"github.com/riouske/gophermart/internal/handler/middleware"
+)
+
+func dial(t *testing.T, hub *events.Hub, userID int64) *websocket.Conn {
+	t.Helper()
+	return dialHandler(t, NewSocketHandler(hub, Options{PingInterval: time.Second}), userID)
+}
+
+func dialHandler(t *testing.T, handler *SocketHandler, userID int64) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(middleware.WithUserID(context.Background(), userID)))
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn, v interface{}) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(v); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+}
+
+func TestSocketHandler_Subscribe(t *testing.T) {
+	hub := events.NewHub(8)
+	conn := dial(t, hub, 1)
+
+	if err := conn.WriteJSON(ClientMessage{Action: "subscribe", Topics: []string{TopicOrders}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var reply ServerMessage
+	readMessage(t, conn, &reply)
+	if reply.Type != "subscribed" || len(reply.Topics) != 1 || reply.Topics[0] != TopicOrders {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	// Balance events are filtered out, events of other users never arrive
+	hub.Publish(events.Event{Type: events.TypeBalanceChanged, UserID: 1, Data: "balance"})
+	hub.Publish(events.Event{Type: events.TypeOrderStatus, UserID: 2, Data: "other"})
+	hub.Publish(events.Event{Type: events.TypeOrderStatus, UserID: 1, Data: "mine"})
+
+	var event struct {
+		Type events.Type `json:"type"`
+		Data string      `json:"data"`
+	}
+	readMessage(t, conn, &event)
+	if event.Type != events.TypeOrderStatus || event.Data != "mine" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestSocketHandler_Unsubscribe(t *testing.T) {
+	hub := events.NewHub(8)
+	conn := dial(t, hub, 1)
+
+	var reply ServerMessage
+	_ = conn.WriteJSON(ClientMessage{Action: "subscribe", Topics: []string{TopicOrders, TopicBalance}})
+	readMessage(t, conn, &reply)
+	if len(reply.Topics) != 2 {
+		t.Fatalf("expected two active topics, got %+v", reply)
+	}
+
+	_ = conn.WriteJSON(ClientMessage{Action: "unsubscribe", Topics: []string{TopicOrders}})
+	readMessage(t, conn, &reply)
+	if reply.Type != "unsubscribed" || len(reply.Topics) != 1 || reply.Topics[0] != TopicBalance {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+}
+
+func TestSocketHandler_InvalidMessages(t *testing.T) {
+	hub := events.NewHub(8)
+	conn := dial(t, hub, 1)
+
+	tests := []string{
+		`{"action": "subscribe", "topics": ["unknown"]}`,
+		`{"action": "dance"}`,
+		`not json`,
+		`{"action": "subscribe", "topics": [`,
+		``,
+		`{"action": "subscribe", "topics": "orders"}`,
+	}
+
+	for _, message := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		var reply ServerMessage
+		readMessage(t, conn, &reply)
+		if reply.Type != "error" || reply.Error == "" {
+			t.Errorf("message %q: expected error reply, got %+v", message, reply)
+		}
+	}
+}
+
+func TestSocketHandler_SlowConsumer(t *testing.T) {
+	hub := events.NewHub(1)
+	conn := dial(t, hub, 1)
+
+	var reply ServerMessage
+	_ = conn.WriteJSON(ClientMessage{Action: "subscribe", Topics: []string{TopicOrders}})
+	readMessage(t, conn, &reply)
+
+	// Flood the subscription faster than the socket drains it
+	for i := 0; i < 1000; i++ {
+		hub.Publish(events.Event{Type: events.TypeOrderStatus, UserID: 1, Data: "flood"})
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Errorf("expected slow consumer close, got %v", err)
+		}
+		return
+	}
+}
+
+func TestSocketHandler_Close(t *testing.T) {
+	handler := NewSocketHandler(events.NewHub(8), Options{PingInterval: time.Second})
+	conn := dialHandler(t, handler, 1)
+
+	var reply ServerMessage
+	_ = conn.WriteJSON(ClientMessage{Action: "subscribe", Topics: []string{TopicOrders}})
+	readMessage(t, conn, &reply)
+
+	handler.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected going away close, got %v", err)
+	}
+}
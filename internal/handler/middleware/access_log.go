@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/riouske/gophermart/internal/response"
+)
+
+// AccessLog writes one line per request with its status, size and latency.
+// Server errors are logged at error level and client errors at warn level.
+// Placed inside RequestID, every line carries the request ID, and the user
+// ID once Auth, further in, has authenticated the request.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := response.Wrap(w)
+		user := &accessLogUser{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogUserKey{}, user))
+
+		defer func() {
+			status := rw.Status()
+			if status == 0 {
+				// Nothing written, net/http replies 200 with an empty body
+				status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("bytes", rw.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			}
+			if userID := user.id.Load(); userID != 0 {
+				attrs = append(attrs, slog.Int64("user_id", userID))
+			}
+			slog.LogAttrs(r.Context(), level, "Request served", attrs...)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+type accessLogUserKey struct{}
+
+// accessLogUser carries the user ID out of Auth, whose context does not
+// reach back to AccessLog. Zero means the request was not authenticated.
+type accessLogUser struct {
+	id atomic.Int64
+}
+
+// recordAccessLogUser hands userID to the AccessLog serving the request, if any
+func recordAccessLogUser(ctx context.Context, userID int64) {
+	if user, ok := ctx.Value(accessLogUserKey{}).(*accessLogUser); ok {
+		user.id.Store(userID)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/logger"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/tests"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := logger.New(&buf, "json", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(log)
+
+	handler := middleware.RequestID(middleware.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders/42", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line struct {
+		Level     string `json:"level"`
+		Msg       string `json:"msg"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Bytes     int64  `json:"bytes"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+	}
+
+	if line.Msg != "Request served" || line.Level != "WARN" {
+		t.Errorf("Expected a warn access log line, got %s %q", line.Level, line.Msg)
+	}
+	if line.Method != http.MethodGet || line.Path != "/api/user/orders/42" {
+		t.Errorf("Expected GET /api/user/orders/42, got %s %s", line.Method, line.Path)
+	}
+	if line.Status != http.StatusNotFound || line.Bytes != 7 {
+		t.Errorf("Expected status 404 and 7 bytes, got %d and %d", line.Status, line.Bytes)
+	}
+	if line.RequestID != "abc-123" {
+		t.Errorf("Expected request ID abc-123, got %q", line.RequestID)
+	}
+}
+
+func TestAccessLog_UserID(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := logger.New(&buf, "json", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(log)
+
+	authService, _ := tests.SetupMemoryAuthService(t)
+	user, token, err := authService.Register(context.Background(), &model.UserCredentials{Login: "accesslog", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// AccessLog sits outside Auth, as in the server
+	handler := middleware.AccessLog(middleware.Auth(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	requests := []struct {
+		name   string
+		token  string
+		userID int64
+	}{
+		{name: "Authenticated", token: token, userID: user.ID},
+		{name: "Unauthenticated", token: "invalid", userID: 0},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+			}
+			userID, ok := line["user_id"].(float64)
+			if tt.userID == 0 && ok {
+				t.Errorf("Expected no user ID, got %v", userID)
+			}
+			if tt.userID != 0 && int64(userID) != tt.userID {
+				t.Errorf("Expected user ID %d, got %v", tt.userID, line["user_id"])
+			}
+		})
+	}
+}
@@ -2,10 +2,17 @@ package middleware
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/logger"
 	"github.com/riouske/gophermart/internal/service"
+	"github.com/riouske/gophermart/internal/tracing"
 )
 
 type contextKey string
@@ -15,31 +22,48 @@ const UserIDKey contextKey = "user_id"
 func Auth(authService *service.AuthService) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			token := parts[1]
-			claims, err := authService.ValidateToken(token)
-			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+			claims, p := authenticate(r, authService)
+			if claims == nil {
+				problem.Write(w, r, p)
 				return
 			}
 
+			recordAccessLogUser(r.Context(), claims.UserID)
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = logger.WithAttrs(ctx, slog.Int64("user_id", claims.UserID))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// authenticate validates the bearer token of the request in a span of its own.
+// It returns the token claims, or nil and the 401 problem to send.
+func authenticate(r *http.Request, authService *service.AuthService) (*service.Claims, *problem.Problem) {
+	_, span := tracing.Tracer().Start(r.Context(), "middleware.Auth")
+	defer span.End()
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		span.SetStatus(codes.Error, "missing authorization header")
+		return nil, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header is missing")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		span.SetStatus(codes.Error, "invalid authorization header")
+		return nil, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header is not a bearer token")
+	}
+
+	claims, err := authService.ValidateToken(parts[1])
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid token")
+		return nil, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Token is invalid or expired")
+	}
+
+	span.SetAttributes(attribute.Int64("user.id", claims.UserID))
+	return claims, nil
+}
+
 func GetUserID(ctx context.Context) (int64, bool) {
 	id, ok := ctx.Value(UserIDKey).(int64)
 	return id, ok
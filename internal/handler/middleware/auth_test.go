@@ -1,6 +1,7 @@
 package middleware_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,14 +13,13 @@ import (
 
 func TestAuthMiddleware(t *testing.T) {
 	// Setup
-	authService, _, db := tests.SetupAuthService(t)
-	defer db.Close()
+	authService, _ := tests.SetupMemoryAuthService(t)
 
 	// Create a test user and generate a token
 	user := &model.User{
 		Login: "authtest",
 	}
-	_, token, err := authService.Register(&model.UserCredentials{
+	_, token, err := authService.Register(context.Background(), &model.UserCredentials{
 		Login:    user.Login,
 		Password: "password123",
 	})
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BodyLimit caps request bodies with http.MaxBytesReader at the limit of
+// the matched route, or fallback. Handlers reading past it get an error and
+// reply 400, so it belongs inside the mux, where the pattern is known.
+func BodyLimit(limits map[string]int64, fallback int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := limits[r.Pattern]
+			if !ok {
+				limit = fallback
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseBodyLimits reads a comma separated list of pattern=size pairs,
+// like "POST /api/user/orders=1KB,POST /api/user/login=4KB"
+func ParseBodyLimits(s string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("body limit %q: expected pattern=size", entry)
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("body limit %q: %w", entry, err)
+		}
+		limits[strings.TrimSpace(pattern)] = size
+	}
+	return limits, nil
+}
+
+// ParseSize reads a size in bytes, optionally suffixed with KB or MB
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "KB"):
+		unit, s = 1<<10, strings.TrimSuffix(s, "KB")
+	case strings.HasSuffix(s, "MB"):
+		unit, s = 1<<20, strings.TrimSuffix(s, "MB")
+	case strings.HasSuffix(s, "B"):
+		s = strings.TrimSuffix(s, "B")
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * unit, nil
+}
@@ -0,0 +1,73 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+)
+
+func TestBodyLimit(t *testing.T) {
+	limits := map[string]int64{"POST /api/user/orders": 4}
+
+	mux := http.NewServeMux()
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	mux.Handle("POST /api/user/orders", middleware.BodyLimit(limits, 8)(read))
+	mux.Handle("POST /api/user/login", middleware.BodyLimit(limits, 8)(read))
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Within route limit", "/api/user/orders", "1234", http.StatusOK},
+		{"Over route limit", "/api/user/orders", "12345", http.StatusBadRequest},
+		{"Within fallback", "/api/user/login", "12345678", http.StatusOK},
+		{"Over fallback", "/api/user/login", "123456789", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseBodyLimits(t *testing.T) {
+	limits, err := middleware.ParseBodyLimits("POST /api/user/orders=1KB, POST /api/user/login = 512 ,GET /x=2mb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{
+		"POST /api/user/orders": 1 << 10,
+		"POST /api/user/login":  512,
+		"GET /x":                2 << 20,
+	}
+	if len(limits) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, limits)
+	}
+	for pattern, size := range want {
+		if limits[pattern] != size {
+			t.Errorf("Expected %s=%d, got %d", pattern, size, limits[pattern])
+		}
+	}
+
+	for _, s := range []string{"POST /x", "POST /x=", "POST /x=0", "POST /x=-1KB", "POST /x=1GB"} {
+		if _, err := middleware.ParseBodyLimits(s); err == nil {
+			t.Errorf("Expected %q to fail", s)
+		}
+	}
+}
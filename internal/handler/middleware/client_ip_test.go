@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.10 ,fd00::/8,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(proxies) != 3 || proxies[1].String() != "192.168.1.10/32" {
+		t.Errorf("Unexpected proxies: %v", proxies)
+	}
+
+	for _, s := range []string{"10.0.0.0/33", "proxy.local", "10.0.0"} {
+		if _, err := middleware.ParseTrustedProxies(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies("10.0.0.0/8,2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{
+			name:       "Direct client",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer cannot forward",
+			remoteAddr: "203.0.113.7:1234",
+			header:     map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Trusted proxy without headers",
+			remoteAddr: "10.0.0.2:1234",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "X-Forwarded-For through a trusted proxy",
+			remoteAddr: "10.0.0.2:1234",
+			header:     map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed hops left of the client are ignored",
+			remoteAddr: "10.0.0.2:1234",
+			header:     map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.3"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "[2001:db8::1]:443",
+			header: map[string]string{
+				"Forwarded":       `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.3`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name:       "Obfuscated hop stops the walk",
+			remoteAddr: "10.0.0.2:1234",
+			header:     map[string]string{"Forwarded": "for=_hidden, for=10.0.0.3"},
+			want:       "10.0.0.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			if got := proxies.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+)
+
+// Content codings understood by Compress
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// Compress decompresses gzip and deflate request bodies, so handlers read
+// plain bytes, and compresses text and JSON responses of at least minSize
+// bytes for clients that accept it. Decompressed bodies are capped at
+// maxBodySize to defuse decompression bombs; reading past it fails.
+func Compress(minSize int, maxBodySize int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+				body, err := decompressBody(encoding, r.Body)
+				if errors.Is(err, errUnsupportedEncoding) {
+					problem.Respond(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedEncoding, err.Error())
+					return
+				}
+				if err != nil {
+					problem.Respond(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "Request body is not valid "+encoding)
+					return
+				}
+
+				r.Body = http.MaxBytesReader(w, body, maxBodySize)
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+				r.ContentLength = -1
+			}
+
+			// WebSocket upgrades take over the connection and HEAD has no body
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Responses are wrapped even for clients that accept no coding,
+			// so that caches learn they vary with Accept-Encoding
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+
+			// A handler that panicked left a partial response, which must
+			// not be flushed as if it were complete
+			completed := false
+			defer func() {
+				if completed {
+					cw.Close()
+				}
+			}()
+			next.ServeHTTP(cw, r)
+			completed = true
+		})
+	}
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+type decompressReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func decompressBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case encodingGzip, "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, closers: []io.Closer{zr, body}}, nil
+	case encodingDeflate:
+		// HTTP deflate is zlib-wrapped
+		zr, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, closers: []io.Closer{zr, body}}, nil
+	case "identity":
+		return body, nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// negotiateEncoding picks gzip over deflate from an Accept-Encoding header,
+// skipping codings the client refused with q=0
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	switch {
+	case accepted[encodingGzip]:
+		return encodingGzip
+	case accepted[encodingDeflate]:
+		return encodingDeflate
+	default:
+		return ""
+	}
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// compressWriter holds the response back until minSize bytes are written,
+// then decides whether compressing it is worth it. An empty encoding never
+// compresses.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	hijack  bool
+	writer  io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the headers and the buffered body, compressed when the
+// response is big enough and of a type that compresses well. Every response
+// of such a type varies with Accept-Encoding, compressed or not.
+func (w *compressWriter) decide(bigEnough bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	compressible := w.compressible()
+	if compressible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if bigEnough && compressible && w.encoding != "" {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		if w.encoding == encodingGzip {
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.writer = gw
+		} else {
+			w.writer = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		mediaType == "application/problem+json" ||
+		strings.HasPrefix(mediaType, "text/")
+}
+
+// Close flushes whatever the handler left in the buffer
+func (w *compressWriter) Close() error {
+	if w.hijack {
+		return nil
+	}
+	if !w.decided {
+		if w.status == 0 {
+			// The handler wrote nothing, let net/http send its default response
+			return nil
+		}
+		return w.decide(false)
+	}
+	if w.writer == nil {
+		return nil
+	}
+
+	err := w.writer.Close()
+	if gw, ok := w.writer.(*gzip.Writer); ok {
+		gw.Reset(io.Discard)
+		gzipWriters.Put(gw)
+	}
+	return err
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(w.buf.Len() >= w.minSize)
+	}
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.hijack = true
+	return hijacker.Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,188 @@
+package middleware_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestCompress_DecompressesRequests(t *testing.T) {
+	var zlibBody bytes.Buffer
+	zw := zlib.NewWriter(&zlibBody)
+	zw.Write([]byte("12345678903"))
+	zw.Close()
+
+	tests := []struct {
+		name         string
+		encoding     string
+		body         []byte
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Gzip body",
+			encoding:     "gzip",
+			body:         gzipBytes(t, []byte("12345678903")),
+			expectedCode: http.StatusOK,
+			expectedBody: "12345678903",
+		},
+		{
+			name:         "Deflate body",
+			encoding:     "deflate",
+			body:         zlibBody.Bytes(),
+			expectedCode: http.StatusOK,
+			expectedBody: "12345678903",
+		},
+		{
+			name:         "Corrupt gzip body",
+			encoding:     "gzip",
+			body:         []byte("not gzip"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Unsupported encoding",
+			encoding:     "br",
+			body:         []byte("whatever"),
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "Decompression bomb",
+			encoding:     "gzip",
+			body:         gzipBytes(t, bytes.Repeat([]byte("0"), 10<<20)),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			handler := middleware.Compress(1024, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				received = string(body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedCode == http.StatusOK && received != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, received)
+			}
+		})
+	}
+}
+
+func TestCompress_CompressesResponses(t *testing.T) {
+	large := `[` + strings.Repeat(`{"number":"12345678903","status":"NEW"},`, 100) + `{}]`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		compressed     bool
+		vary           bool
+	}{
+		{name: "Large JSON", acceptEncoding: "gzip", contentType: "application/json", body: large, compressed: true, vary: true},
+		{name: "Small JSON", acceptEncoding: "gzip", contentType: "application/json", body: `{"current":1}`, compressed: false, vary: true},
+		{name: "Client does not accept gzip", acceptEncoding: "", contentType: "application/json", body: large, compressed: false, vary: true},
+		{name: "Client refuses gzip", acceptEncoding: "gzip;q=0", contentType: "application/json", body: large, compressed: false, vary: true},
+		{name: "Binary content", acceptEncoding: "gzip", contentType: "image/png", body: large, compressed: false, vary: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := middleware.Compress(1024, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusOK)
+				io.WriteString(w, tt.body)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			if vary := rr.Header().Get("Vary") == "Accept-Encoding"; vary != tt.vary {
+				t.Errorf("Expected Vary: Accept-Encoding to be %v, got %q", tt.vary, rr.Header().Get("Vary"))
+			}
+
+			body := rr.Body.Bytes()
+			if tt.compressed {
+				if rr.Header().Get("Content-Encoding") != "gzip" {
+					t.Fatalf("Expected a gzip response, got Content-Encoding %q", rr.Header().Get("Content-Encoding"))
+				}
+				gr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to read gzip response: %v", err)
+				}
+				if body, err = io.ReadAll(gr); err != nil {
+					t.Fatalf("Failed to read gzip response: %v", err)
+				}
+			} else if rr.Header().Get("Content-Encoding") != "" {
+				t.Errorf("Expected an uncompressed response, got Content-Encoding %q", rr.Header().Get("Content-Encoding"))
+			}
+
+			if string(body) != tt.body {
+				t.Errorf("Response body does not match what the handler wrote")
+			}
+		})
+	}
+}
+
+func TestCompress_PanicIsNotFlushed(t *testing.T) {
+	handler := middleware.Compress(1024, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"partial":`)
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to reach the caller")
+			}
+		}()
+		handler.ServeHTTP(rr, req)
+	}()
+
+	// Nothing was sent, so Recover can still answer with a 500
+	if rr.Flushed || rr.Body.Len() != 0 {
+		t.Errorf("Expected the partial response to be dropped, got %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/idempotency"
+	"github.com/riouske/gophermart/internal/response"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the response headers stored with the response.
+// The others, like the request ID and rate limit state, belong to each
+// attempt rather than to the original response.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// Idempotency replays the stored response to requests repeating the
+// Idempotency-Key of an earlier one, so retries never apply twice. Keys are
+// scoped to the user and the route, and expire after ttl. Reusing a key with
+// another payload, or while the first request is still running, is a 409.
+// A request that has not answered within lease is assumed lost with its
+// instance, and a retry takes its key over. The handler's context ends with
+// the lease, so that the request cannot still apply once a retry has the key.
+// Server errors are not stored, so that the client can retry them.
+func Idempotency(store idempotency.Store, ttl, lease time.Duration, maxBodySize int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientKey := r.Header.Get(IdempotencyKeyHeader)
+			if clientKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(clientKey) > maxIdempotencyKeyLength {
+				problem.Respond(w, r, http.StatusBadRequest, problem.CodeInvalidIdempotencyKey,
+					"Idempotency-Key may not exceed "+strconv.Itoa(maxIdempotencyKeyLength)+" characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			if err != nil {
+				problem.InvalidBody(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := idempotencyKey(r, clientKey)
+			fingerprint := requestFingerprint(r, body)
+			token, err := idempotency.NewToken()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to generate idempotency token", "error", err)
+				problem.Internal(w, r)
+				return
+			}
+
+			// Taken before reserving, so that the handler gives up no later
+			// than the store hands the key to a retry
+			leaseEnd := time.Now().Add(lease)
+			record, err := store.Reserve(r.Context(), key, token, fingerprint, ttl, lease)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to reserve idempotency key", "error", err)
+				problem.Internal(w, r)
+				return
+			}
+			if record != nil {
+				replayIdempotent(w, r, record, fingerprint)
+				return
+			}
+
+			ctx, cancel := context.WithDeadline(r.Context(), leaseEnd)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			rec := &responseRecorder{Writer: response.Wrap(w)}
+			completed := false
+			defer func() {
+				// Keep the key only for responses worth replaying; a panic or
+				// a server error leaves the client free to try again
+				status := rec.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if completed && status < http.StatusInternalServerError {
+					stored := &idempotency.Response{Status: status, Header: rec.storedHeader(), Body: rec.body.Bytes()}
+					err := store.Complete(context.WithoutCancel(r.Context()), key, token, stored)
+					if errors.Is(err, idempotency.ErrReservationLost) {
+						slog.WarnContext(r.Context(), "Idempotency key was taken over before the response was stored")
+					} else if err != nil {
+						slog.ErrorContext(r.Context(), "Failed to store idempotent response", "error", err)
+					}
+					return
+				}
+				if err := store.Release(context.WithoutCancel(r.Context()), key, token); err != nil {
+					slog.ErrorContext(r.Context(), "Failed to release idempotency key", "error", err)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+			completed = true
+		})
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, r *http.Request, record *idempotency.Record, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		problem.Respond(w, r, http.StatusConflict, problem.CodeIdempotencyKeyReused,
+			"Idempotency-Key was already used with another request")
+		return
+	}
+	if record.Response == nil {
+		w.Header().Set("Retry-After", "1")
+		problem.Respond(w, r, http.StatusConflict, problem.CodeIdempotencyKeyInProgress,
+			"A request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	for name, values := range record.Response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Response.Status)
+	if _, err := w.Write(record.Response.Body); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to replay idempotent response", "error", err)
+	}
+}
+
+// idempotencyKey scopes the client key to the user and the route, so that
+// clients cannot see each other's responses
+func idempotencyKey(r *http.Request, clientKey string) string {
+	var user string
+	if userID, ok := GetUserID(r.Context()); ok {
+		user = strconv.FormatInt(userID, 10)
+	}
+	return user + "|" + r.Pattern + "|" + clientKey
+}
+
+// requestFingerprint identifies the payload a key is used with
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy
+// of the body
+type responseRecorder struct {
+	*response.Writer
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.Writer.Write(b)
+}
+
+func (r *responseRecorder) storedHeader() http.Header {
+	header := make(http.Header)
+	for _, name := range replayedHeaders {
+		if values := r.Header().Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	return header
+}
@@ -0,0 +1,176 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/idempotency"
+)
+
+func TestIdempotency(t *testing.T) {
+	var (
+		calls   int
+		status  = http.StatusOK
+		started chan struct{}
+		release chan struct{}
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/user/balance/withdraw", middleware.Idempotency(idempotency.NewLocalStore(), time.Hour, time.Minute, 1024)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if started != nil {
+				close(started)
+				<-release
+			}
+			calls++
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Attempt", "first")
+			w.WriteHeader(status)
+			w.Write(body)
+		})))
+
+	send := func(key string, userID int64, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		req = req.WithContext(middleware.WithUserID(req.Context(), userID))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	problemCode := func(t *testing.T, rr *httptest.ResponseRecorder) string {
+		t.Helper()
+		var p problem.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("Failed to decode problem: %v", err)
+		}
+		return p.Code
+	}
+
+	body := `{"order":"2377225624","sum":751}`
+
+	t.Run("Retry replays the first response", func(t *testing.T) {
+		calls = 0
+		first := send("withdraw-1", 1, body)
+		retry := send("withdraw-1", 1, body)
+
+		if calls != 1 {
+			t.Fatalf("Expected the handler to run once, ran %d times", calls)
+		}
+		if retry.Code != first.Code || retry.Body.String() != body {
+			t.Errorf("Expected %d %q replayed, got %d %q", first.Code, body, retry.Code, retry.Body.String())
+		}
+		if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+			t.Error("Expected the replay to be flagged")
+		}
+		if retry.Header().Get("Content-Type") != "application/json" || retry.Header().Get("X-Attempt") != "" {
+			t.Errorf("Expected only the stored headers, got %v", retry.Header())
+		}
+	})
+
+	t.Run("Keys are scoped to the user", func(t *testing.T) {
+		calls = 0
+		send("withdraw-2", 1, body)
+		send("withdraw-2", 2, body)
+		if calls != 2 {
+			t.Errorf("Expected the handler to run for each user, ran %d times", calls)
+		}
+	})
+
+	t.Run("Another payload is a conflict", func(t *testing.T) {
+		send("withdraw-3", 1, body)
+		rr := send("withdraw-3", 1, `{"order":"2377225624","sum":1}`)
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if code := problemCode(t, rr); code != problem.CodeIdempotencyKeyReused {
+			t.Errorf("Expected code %q, got %q", problem.CodeIdempotencyKeyReused, code)
+		}
+	})
+
+	t.Run("Concurrent retry is a conflict", func(t *testing.T) {
+		started = make(chan struct{})
+		release = make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			send("withdraw-4", 1, body)
+		}()
+
+		// Retry while the first request holds the key
+		<-started
+		rr := send("withdraw-4", 1, body)
+		close(release)
+		<-done
+		started = nil
+
+		if rr.Code != http.StatusConflict || rr.Header().Get("Retry-After") == "" {
+			t.Fatalf("Expected a conflict with Retry-After, got %d", rr.Code)
+		}
+		if code := problemCode(t, rr); code != problem.CodeIdempotencyKeyInProgress {
+			t.Errorf("Expected code %q, got %q", problem.CodeIdempotencyKeyInProgress, code)
+		}
+	})
+
+	t.Run("Server errors are not stored", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+		send("withdraw-5", 1, body)
+		status = http.StatusOK
+		if rr := send("withdraw-5", 1, body); rr.Code != http.StatusOK || calls != 2 {
+			t.Errorf("Expected the retry to run again, got %d after %d calls", rr.Code, calls)
+		}
+	})
+
+	t.Run("Requests without a key pass through", func(t *testing.T) {
+		calls = 0
+		send("", 1, body)
+		send("", 1, body)
+		if calls != 2 {
+			t.Errorf("Expected the handler to run twice, ran %d times", calls)
+		}
+	})
+
+	t.Run("Overlong key is rejected", func(t *testing.T) {
+		rr := send(strings.Repeat("k", 256), 1, body)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if code := problemCode(t, rr); code != problem.CodeInvalidIdempotencyKey {
+			t.Errorf("Expected code %q, got %q", problem.CodeInvalidIdempotencyKey, code)
+		}
+	})
+}
+
+func TestIdempotency_LeaseDeadline(t *testing.T) {
+	lease := time.Minute
+	var deadline time.Time
+	var ok bool
+	handler := middleware.Idempotency(idempotency.NewLocalStore(), time.Hour, lease, 1024)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok = r.Context().Deadline()
+		}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{}`))
+	req.Header.Set(middleware.IdempotencyKeyHeader, "withdraw-1")
+	before := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	after := time.Now()
+
+	if !ok {
+		t.Fatal("Expected the handler context to have a deadline")
+	}
+	if deadline.Before(before.Add(lease)) || deadline.After(after.Add(lease)) {
+		t.Errorf("Expected the deadline at the end of the lease, got %v", deadline.Sub(before))
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/openapi"
+	"github.com/riouske/gophermart/internal/response"
+)
+
+// ValidateRequests rejects requests breaking the OpenAPI contract with a 400
+// before they reach the handler. Routes missing from the contract pass
+// through. It needs the matched pattern, so it belongs inside the mux.
+func ValidateRequests(v *openapi.Validator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := v.ValidateRequest(r)
+			if err != nil && !errors.Is(err, openapi.ErrUndocumented) {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					problem.InvalidBody(w, r, err)
+					return
+				}
+				problem.Respond(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ValidateResponses checks responses against the OpenAPI contract and hands
+// the violations to report; the response is sent either way. Bodies are
+// held back until the handler returns, so it is meant for tests and
+// staging rather than production. WebSocket upgrades pass through.
+func ValidateResponses(v *openapi.Validator, report func(r *http.Request, err error)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			buf := &bufferedResponse{ResponseWriter: w}
+			rw := response.Wrap(buf)
+			next.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if err := v.ValidateResponse(r, status, w.Header(), buf.body.Bytes()); err != nil {
+				report(r, err)
+			}
+			w.WriteHeader(status)
+			w.Write(buf.body.Bytes())
+		})
+	}
+}
+
+// bufferedResponse holds back the status and body; the response.Writer
+// around it keeps the status. Headers go straight to the underlying
+// writer, as nothing is sent before WriteHeader.
+type bufferedResponse struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
@@ -0,0 +1,115 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/openapi"
+)
+
+func TestValidateRequests(t *testing.T) {
+	v, err := openapi.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received string
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/user/login", middleware.BodyLimit(nil, 64)(middleware.ValidateRequests(v)(echo)))
+	mux.Handle("GET /healthz", middleware.ValidateRequests(v)(echo))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Valid request", http.MethodPost, "/api/user/login", `{"login":"a","password":"b"}`, http.StatusOK, ""},
+		{"Missing field", http.MethodPost, "/api/user/login", `{"login":"a"}`, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{"Body too large", http.MethodPost, "/api/user/login", `{"login":"` + strings.Repeat("a", 64) + `","password":"b"}`, http.StatusBadRequest, problem.CodeBodyTooLarge},
+		{"Undocumented route", http.MethodGet, "/healthz", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantCode == "" {
+				if received != tt.body {
+					t.Errorf("Expected the handler to read %q, got %q", tt.body, received)
+				}
+				return
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if p.Code != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, p.Code)
+			}
+		})
+	}
+}
+
+func TestValidateResponses(t *testing.T) {
+	v, err := openapi.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported error
+	validate := middleware.ValidateResponses(v, func(r *http.Request, err error) {
+		reported = err
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/user/balance", validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(r.URL.Query().Get("body")))
+	})))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantReport bool
+	}{
+		{"Matching response", `{"current":500.5,"withdrawn":42}`, false},
+		{"Missing field", `{"current":500.5}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reported = nil
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/balance?body="+tt.body, nil))
+
+			if (reported != nil) != tt.wantReport {
+				t.Errorf("Expected a report %v, got %v", tt.wantReport, reported)
+			}
+			// The response goes out either way
+			if rr.Code != http.StatusOK || rr.Body.String() != tt.body {
+				t.Errorf("Expected %q sent, got %d %q", tt.body, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/ratelimit"
+)
+
+// RateLimit limits requests per route with token buckets. Clients are told
+// apart by user ID once authenticated, so it belongs after Auth, and by IP
+// otherwise, as forwarded by the trusted proxies. When the store fails,
+// requests are let through rather than turning a storage outage into an API
+// outage.
+func RateLimit(store ratelimit.Store, limits *ratelimit.Limits, proxies TrustedProxies) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The pattern is set by the mux, so every path of a route shares a bucket
+			limit, ok := limits.For(r.Pattern)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), rateLimitKey(r, proxies), limit)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to check rate limit", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", seconds(result.Reset))
+			header.Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+seconds(limit.Per))
+
+			if !result.Allowed {
+				header.Set("Retry-After", seconds(result.RetryAfter))
+				problem.Respond(w, r, http.StatusTooManyRequests, problem.CodeRateLimited,
+					"Rate limit of "+limit.String()+" exceeded, retry in "+seconds(result.RetryAfter)+"s")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the bucket of the client for the matched route
+func rateLimitKey(r *http.Request, proxies TrustedProxies) string {
+	if userID, ok := GetUserID(r.Context()); ok {
+		return r.Pattern + "|user:" + strconv.FormatInt(userID, 10)
+	}
+	return r.Pattern + "|ip:" + proxies.ClientIP(r)
+}
+
+// seconds formats d in whole seconds, rounded up so that clients waiting
+// that long are not rejected again
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
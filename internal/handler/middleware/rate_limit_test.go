@@ -0,0 +1,135 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/ratelimit"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	limits, err := ratelimit.ParseLimits("POST /api/user/orders=2/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newMux := func(store ratelimit.Store) *http.ServeMux {
+		mux := http.NewServeMux()
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		limited := middleware.RateLimit(store, limits, nil)
+		mux.Handle("POST /api/user/orders", limited(ok))
+		mux.Handle("GET /api/user/orders", limited(ok))
+		return mux
+	}
+
+	send := func(mux http.Handler, method, remoteAddr string, userID int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/user/orders", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != 0 {
+			req = req.WithContext(middleware.WithUserID(req.Context(), userID))
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Rejects past the limit with headers", func(t *testing.T) {
+		mux := newMux(ratelimit.NewLocalStore())
+
+		for i := 0; i < 2; i++ {
+			if rr := send(mux, http.MethodPost, "10.0.0.1:1234", 1); rr.Code != http.StatusOK {
+				t.Fatalf("Expected request %d to pass, got %d", i+1, rr.Code)
+			}
+		}
+
+		rr := send(mux, http.MethodPost, "10.0.0.1:1234", 1)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		expected := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "60",
+			"RateLimit-Policy":    "2;w=60",
+			"Retry-After":         "30",
+			"Content-Type":        problem.ContentType,
+		}
+		for name, value := range expected {
+			if got := rr.Header().Get(name); got != value {
+				t.Errorf("Expected %s %q, got %q", name, value, got)
+			}
+		}
+	})
+
+	t.Run("Buckets are per user, IP and route", func(t *testing.T) {
+		mux := newMux(ratelimit.NewLocalStore())
+
+		for i := 0; i < 2; i++ {
+			send(mux, http.MethodPost, "10.0.0.1:1234", 1)
+		}
+
+		// Same user from another address is still limited
+		if rr := send(mux, http.MethodPost, "10.0.0.2:1234", 1); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the user to be limited, got %d", rr.Code)
+		}
+		// Another user from the same address is not
+		if rr := send(mux, http.MethodPost, "10.0.0.1:1234", 2); rr.Code != http.StatusOK {
+			t.Errorf("Expected another user to pass, got %d", rr.Code)
+		}
+		// Anonymous clients are told apart by IP
+		if rr := send(mux, http.MethodPost, "10.0.0.1:1234", 0); rr.Code != http.StatusOK {
+			t.Errorf("Expected an anonymous client to pass, got %d", rr.Code)
+		}
+		// Routes without a limit and without a default are not limited
+		if rr := send(mux, http.MethodGet, "10.0.0.1:1234", 1); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("Expected an unlimited route, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Anonymous clients behind a trusted proxy", func(t *testing.T) {
+		proxies, err := middleware.ParseTrustedProxies("10.0.0.0/8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		limited := middleware.RateLimit(ratelimit.NewLocalStore(), limits, proxies)
+		mux := http.NewServeMux()
+		mux.Handle("POST /api/user/orders", limited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+		sendFor := func(client string) int {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", client)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			return rr.Code
+		}
+
+		for i := 0; i < 2; i++ {
+			sendFor("203.0.113.1")
+		}
+		if code := sendFor("203.0.113.1"); code != http.StatusTooManyRequests {
+			t.Errorf("Expected the forwarded client to be limited, got %d", code)
+		}
+		// Other clients of the same proxy have their own buckets
+		if code := sendFor("203.0.113.2"); code != http.StatusOK {
+			t.Errorf("Expected another client of the proxy to pass, got %d", code)
+		}
+	})
+
+	t.Run("Store failure lets requests through", func(t *testing.T) {
+		if rr := send(newMux(failingStore{}), http.MethodPost, "10.0.0.1:1234", 1); rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
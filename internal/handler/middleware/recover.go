@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+	"github.com/riouske/gophermart/internal/response"
+)
+
+// Recover turns a panic in a handler into a logged 500, instead of the
+// server silently dropping the connection. http.ErrAbortHandler is let
+// through, as it is the sanctioned way to abort a response.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := response.Wrap(w)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			slog.ErrorContext(r.Context(), "Panic while serving request",
+				"panic", fmt.Sprint(v),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+
+			// Once the status line is out the client can only be told by
+			// cutting the connection short
+			if rw.Written() {
+				panic(http.ErrAbortHandler)
+			}
+			problem.Internal(rw, r)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
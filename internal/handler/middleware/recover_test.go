@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/handler/problem"
+)
+
+func TestRecover(t *testing.T) {
+	t.Run("Panic before writing replies 500", func(t *testing.T) {
+		handler := middleware.RequestID(middleware.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/orders", nil))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("Failed to decode problem: %v", err)
+		}
+		if p.Code != problem.CodeInternal {
+			t.Errorf("Expected code %q, got %q", problem.CodeInternal, p.Code)
+		}
+		if p.RequestID == "" || p.RequestID != rr.Header().Get(middleware.RequestIDHeader) {
+			t.Errorf("Expected the request ID in the problem, got %q", p.RequestID)
+		}
+	})
+
+	t.Run("Panic after writing aborts the response", func(t *testing.T) {
+		handler := middleware.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("boom")
+		}))
+
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("Expected http.ErrAbortHandler, got %v", v)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{name: "Generated when missing", incoming: "", reused: false},
+		{name: "Reused when valid", incoming: "abc-123", reused: true},
+		{name: "Replaced when it contains spaces", incoming: "abc 123", reused: false},
+		{name: "Replaced when too long", incoming: strings.Repeat("a", 129), reused: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen, _ = middleware.GetRequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(middleware.RequestIDHeader)
+			if got == "" {
+				t.Fatal("Expected a request ID in the response")
+			}
+			if got != seen {
+				t.Errorf("Response ID %q does not match context ID %q", got, seen)
+			}
+			if tt.reused && got != tt.incoming {
+				t.Errorf("Expected incoming ID %q to be reused, got %q", tt.incoming, got)
+			}
+			if !tt.reused && got == tt.incoming {
+				t.Errorf("Expected incoming ID %q to be replaced", tt.incoming)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Package problem writes error responses as RFC 7807 problem+json documents.
+// Every problem carries a stable machine-readable code next to the HTTP
+// status, so clients can tell apart errors sharing a status, such as an
+// invalid order number and an already registered withdrawal (both 422).
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+const ContentType = "application/problem+json"
+
+// TypePrefix is prepended to the code to build the problem type URI
+const TypePrefix = "/problems/"
+
+// Stable error codes. Clients may rely on them, so never rename one.
+const (
+	CodeInvalidJSON              = "invalid_json"
+	CodeBodyTooLarge             = "body_too_large"
+	CodeUnsupportedEncoding      = "unsupported_encoding"
+	CodeMalformedBody            = "malformed_body"
+	CodeInvalidRequest           = "invalid_request"
+	CodeUnauthorized             = "unauthorized"
+	CodeInvalidToken             = "invalid_token"
+	CodeMissingCredentials       = "missing_credentials"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeLoginTaken               = "login_taken"
+	CodeEmptyOrderNumber         = "empty_order_number"
+	CodeInvalidOrderNumber       = "invalid_order_number"
+	CodeTooManyOrders            = "too_many_orders"
+	CodeOrderExistsForUser       = "order_exists_for_another_user"
+	CodeOrderNotFound            = "order_not_found"
+	CodeInsufficientFunds        = "insufficient_funds"
+	CodeWithdrawalExists         = "withdrawal_exists"
+	CodeInvalidWebhookURL        = "invalid_webhook_url"
+	CodeInvalidWebhookEvent      = "invalid_webhook_event"
+	CodeInvalidID                = "invalid_id"
+	CodeWebhookNotFound          = "webhook_not_found"
+	CodeDeliveryNotFound         = "delivery_not_found"
+	CodeDeliveryInFlight         = "delivery_in_flight"
+	CodeNotFound                 = "not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeRateLimited              = "rate_limited"
+	CodeInvalidIdempotencyKey    = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeInternal                 = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   TypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// mapping ties a domain error to the status the API spec requires for it
+type mapping struct {
+	err    error
+	status int
+	code   string
+}
+
+var mappings = []mapping{
+	{service.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials},
+	{repository.ErrUserExists, http.StatusConflict, CodeLoginTaken},
+	{repository.ErrOrderExistsForUser, http.StatusConflict, CodeOrderExistsForUser},
+	{repository.ErrOrderNotFound, http.StatusNotFound, CodeOrderNotFound},
+	{service.ErrInsufficientFunds, http.StatusPaymentRequired, CodeInsufficientFunds},
+	{repository.ErrWithdrawalExists, http.StatusUnprocessableEntity, CodeWithdrawalExists},
+	{service.ErrInvalidWebhookURL, http.StatusUnprocessableEntity, CodeInvalidWebhookURL},
+	{service.ErrWebhookURLNotAllowed, http.StatusUnprocessableEntity, CodeInvalidWebhookURL},
+	{service.ErrInvalidWebhookEvent, http.StatusUnprocessableEntity, CodeInvalidWebhookEvent},
+	{repository.ErrWebhookNotFound, http.StatusNotFound, CodeWebhookNotFound},
+	{repository.ErrDeliveryNotFound, http.StatusNotFound, CodeDeliveryNotFound},
+	{repository.ErrDeliveryInFlight, http.StatusConflict, CodeDeliveryInFlight},
+}
+
+// FromError maps a domain error to its problem. Unknown errors become a
+// 500 without detail, so internals never leak to the client.
+func FromError(err error) *Problem {
+	for _, m := range mappings {
+		if errors.Is(err, m.err) {
+			return New(m.status, m.code, m.err.Error())
+		}
+	}
+	return New(http.StatusInternalServerError, CodeInternal, "")
+}
+
+// Write sends p, filling in the request path and the request ID
+// set by middleware.RequestID
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get("X-Request-ID")
+	}
+
+	// Drop headers meant for a successful response
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode problem", "error", err)
+	}
+}
+
+// Error writes the problem err maps to
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	Write(w, r, FromError(err))
+}
+
+// Respond writes a problem built from status, code and detail
+func Respond(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// InvalidBody reports a request body that failed to read or decode, telling
+// an oversized body and malformed JSON apart from a broken stream. All of them
+// are a 400, as the spec requires for a malformed request.
+func InvalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		maxBytesErr  *http.MaxBytesError
+		syntaxErr    *json.SyntaxError
+		unmarshalErr *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		Respond(w, r, http.StatusBadRequest, CodeBodyTooLarge, maxBytesErr.Error())
+	case errors.As(err, &syntaxErr), errors.As(err, &unmarshalErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		Respond(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON")
+	default:
+		Respond(w, r, http.StatusBadRequest, CodeMalformedBody, "Request body could not be read")
+	}
+}
+
+// Unauthorized reports a request that reached a protected handler
+// without an authenticated user
+func Unauthorized(w http.ResponseWriter, r *http.Request) {
+	Respond(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required")
+}
+
+// Internal reports an unexpected failure, already logged by the caller
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Respond(w, r, http.StatusInternalServerError, CodeInternal, "")
+}
@@ -0,0 +1,142 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/service"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Order of another user",
+			err:            repository.ErrOrderExistsForUser,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   CodeOrderExistsForUser,
+		},
+		{
+			name:           "Wrapped invalid credentials",
+			err:            fmt.Errorf("login: %w", service.ErrInvalidCredentials),
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeInvalidCredentials,
+		},
+		{
+			name:           "Insufficient funds",
+			err:            service.ErrInsufficientFunds,
+			expectedStatus: http.StatusPaymentRequired,
+			expectedCode:   CodeInsufficientFunds,
+		},
+		{
+			name:           "Withdrawal exists",
+			err:            repository.ErrWithdrawalExists,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   CodeWithdrawalExists,
+		},
+		{
+			name:           "Unknown error",
+			err:            errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := FromError(tt.err)
+			if p.Status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, p.Status)
+			}
+			if p.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, p.Code)
+			}
+			if p.Type != TypePrefix+tt.expectedCode {
+				t.Errorf("Expected type %q, got %q", TypePrefix+tt.expectedCode, p.Type)
+			}
+			if tt.expectedStatus == http.StatusInternalServerError && p.Detail != "" {
+				t.Errorf("Expected no detail for an internal error, got %q", p.Detail)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Request-ID", "abc-123")
+	r := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+
+	Respond(rr, r, http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "Order number fails the Luhn check")
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status code %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected Content-Type %q, got %q", ContentType, ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	expected := Problem{
+		Type:      "/problems/invalid_order_number",
+		Title:     "Unprocessable Entity",
+		Status:    http.StatusUnprocessableEntity,
+		Detail:    "Order number fails the Luhn check",
+		Instance:  "/api/user/orders",
+		Code:      CodeInvalidOrderNumber,
+		RequestID: "abc-123",
+	}
+	if p != expected {
+		t.Errorf("Expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestInvalidBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		limit        int64
+		expectedCode string
+	}{
+		{name: "Syntax error", body: `{"login":`, limit: 1024, expectedCode: CodeInvalidJSON},
+		{name: "Empty body", body: ``, limit: 1024, expectedCode: CodeInvalidJSON},
+		{name: "Wrong type", body: `{"login":1}`, limit: 1024, expectedCode: CodeInvalidJSON},
+		{name: "Too large", body: `{"login":"` + strings.Repeat("a", 64) + `"}`, limit: 16, expectedCode: CodeBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(tt.body))
+			r.Body = http.MaxBytesReader(rr, r.Body, tt.limit)
+
+			var v struct {
+				Login string `json:"login"`
+			}
+			InvalidBody(rr, r, json.NewDecoder(r.Body).Decode(&v))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			var p Problem
+			if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if p.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, p.Code)
+			}
+		})
+	}
+}
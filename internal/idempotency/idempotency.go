@@ -0,0 +1,81 @@
+// Package idempotency stores the responses of requests sent with an
+// Idempotency-Key, so that a client retrying a request it got no answer to
+// gets the original response instead of having the request applied twice.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ErrReservationLost is returned by Complete when the lease of the
+// reservation ran out and another request took the key over
+var ErrReservationLost = errors.New("idempotency key reservation was taken over")
+
+// Response is a stored response, replayed to retries
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Record is what a store holds for a key
+type Record struct {
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string
+	// Response is nil while the first request is still being handled
+	Response *Response
+}
+
+// Store keeps idempotency records until they expire
+type Store interface {
+	// Reserve claims key for a request with fingerprint for ttl. It returns
+	// nil when the key was free or expired, and the existing record otherwise.
+	// A reservation that is still not completed after lease is taken to have
+	// died with its request, and the key is handed to the next caller.
+	// The token, from NewToken, identifies the reservation to Complete and
+	// Release.
+	Reserve(ctx context.Context, key, token, fingerprint string, ttl, lease time.Duration) (*Record, error)
+	// Complete stores the response of the request holding key with token.
+	// It fails with ErrReservationLost when another request took key over.
+	Complete(ctx context.Context, key, token string, response *Response) error
+	// Release frees key, so the request may be retried from scratch. A key
+	// taken over by another request is left alone.
+	Release(ctx context.Context, key, token string) error
+}
+
+// NewToken returns a random token identifying a reservation
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Pruner is implemented by stores that need expired records removed
+type Pruner interface {
+	Prune(ctx context.Context) error
+}
+
+// RunPruner removes expired records every interval until ctx is cancelled
+func RunPruner(ctx context.Context, pruner Pruner, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pruner.Prune(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to prune idempotency keys", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	record      Record
+	token       string
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// free reports whether the key may be reserved again at now
+func (e *entry) free(now time.Time) bool {
+	if !now.Before(e.expiresAt) {
+		return true
+	}
+	return e.record.Response == nil && !now.Before(e.lockedUntil)
+}
+
+// LocalStore keeps records in process memory, for the memory storage
+type LocalStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func NewLocalStore() *LocalStore {
+	return &LocalStore{
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+func (s *LocalStore) Reserve(_ context.Context, key, token, fingerprint string, ttl, lease time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.entries[key]; ok && !e.free(now) {
+		record := e.record
+		return &record, nil
+	}
+
+	s.entries[key] = &entry{
+		record:      Record{Fingerprint: fingerprint},
+		token:       token,
+		lockedUntil: now.Add(lease),
+		expiresAt:   now.Add(ttl),
+	}
+	return nil, nil
+}
+
+func (s *LocalStore) Complete(_ context.Context, key, token string, response *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.token != token {
+		return ErrReservationLost
+	}
+	e.record.Response = response
+	return nil
+}
+
+func (s *LocalStore) Release(_ context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.token == token {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Prune deletes expired records
+func (s *LocalStore) Prune(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	store := NewLocalStore()
+	store.now = func() time.Time { return now }
+
+	record, err := store.Reserve(ctx, "key", "t1", "a", time.Hour, time.Minute)
+	if err != nil || record != nil {
+		t.Fatalf("Expected a free key, got %+v, %v", record, err)
+	}
+
+	// In progress until completed
+	record, _ = store.Reserve(ctx, "key", "t2", "a", time.Hour, time.Minute)
+	if record == nil || record.Fingerprint != "a" || record.Response != nil {
+		t.Fatalf("Expected an in-progress record, got %+v", record)
+	}
+
+	response := &Response{Status: http.StatusAccepted}
+	if err := store.Complete(ctx, "key", "t1", response); err != nil {
+		t.Fatal(err)
+	}
+	record, _ = store.Reserve(ctx, "key", "t3", "b", time.Hour, time.Minute)
+	if record == nil || record.Fingerprint != "a" || record.Response != response {
+		t.Fatalf("Expected the completed record, got %+v", record)
+	}
+
+	// Expired keys are free again
+	now = now.Add(time.Hour)
+	if record, _ := store.Reserve(ctx, "key", "t4", "b", time.Hour, time.Minute); record != nil {
+		t.Fatalf("Expected the expired key to be free, got %+v", record)
+	}
+
+	// Released keys are free again
+	if err := store.Release(ctx, "key", "t4"); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := store.Reserve(ctx, "key", "t5", "c", time.Hour, time.Minute); record != nil {
+		t.Fatalf("Expected the released key to be free, got %+v", record)
+	}
+
+	now = now.Add(time.Hour)
+	if err := store.Prune(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("Expected expired keys to be pruned, got %d", len(store.entries))
+	}
+}
+
+func TestLocalStore_Lease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	store := NewLocalStore()
+	store.now = func() time.Time { return now }
+
+	if record, _ := store.Reserve(ctx, "key", "t1", "a", time.Hour, time.Minute); record != nil {
+		t.Fatalf("Expected a free key, got %+v", record)
+	}
+
+	// Held while the lease lasts
+	now = now.Add(time.Minute - time.Second)
+	record, _ := store.Reserve(ctx, "key", "t2", "b", time.Hour, time.Minute)
+	if record == nil || record.Fingerprint != "a" || record.Response != nil {
+		t.Fatalf("Expected the in-progress record, got %+v", record)
+	}
+
+	// The first request never completed, a retry takes the key over
+	now = now.Add(time.Second)
+	if record, _ := store.Reserve(ctx, "key", "t3", "b", time.Hour, time.Minute); record != nil {
+		t.Fatalf("Expected the abandoned key to be taken over, got %+v", record)
+	}
+
+	// The first request can neither complete nor release the key it lost
+	response := &Response{Status: http.StatusOK}
+	if err := store.Complete(ctx, "key", "t1", response); !errors.Is(err, ErrReservationLost) {
+		t.Fatalf("Complete after a takeover: got %v, want %v", err, ErrReservationLost)
+	}
+	if err := store.Release(ctx, "key", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	record, _ = store.Reserve(ctx, "key", "t4", "c", time.Hour, time.Minute)
+	if record == nil || record.Fingerprint != "b" || record.Response != nil {
+		t.Fatalf("Expected the key held by the retry, got %+v", record)
+	}
+
+	// Completed records outlive the lease
+	if err := store.Complete(ctx, "key", "t3", response); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	record, _ = store.Reserve(ctx, "key", "t5", "c", time.Hour, time.Minute)
+	if record == nil || record.Response != response {
+		t.Fatalf("Expected the completed record, got %+v", record)
+	}
+}
@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNew_AddsContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := WithAttrs(context.Background(), slog.String("request_id", "abc"))
+	ctx = WithAttrs(ctx, slog.Int64("user_id", 42))
+	log.InfoContext(ctx, "Order uploaded", "order", "12345678903")
+	log.DebugContext(ctx, "Hidden below the configured level")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected exactly one JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != "abc" || line["user_id"] != float64(42) || line["order"] != "12345678903" {
+		t.Errorf("unexpected log line %v", line)
+	}
+}
+
+func TestNew_RejectsUnknownSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := New(&bytes.Buffer{}, "text", "loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
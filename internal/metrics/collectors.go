@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"github.com/riouske/gophermart/internal/db"
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// RegisterDB exports the database/sql pool statistics of database.
+// name tells pools apart when the process opens more than one.
+func RegisterDB(database *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(database, name))
+}
+
+// RegisterPool exports the statistics of the pgx storage backend pool
+func RegisterPool(pool *pgxpool.Pool) {
+	Registry.MustRegister(&poolCollector{pool: pool})
+}
+
+var (
+	poolMaxConnsDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolTotalConnsDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_total_conns", "Connections currently open, idle or in use.", nil, nil)
+	poolAcquiredConnsDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_acquired_conns", "Connections currently in use.", nil, nil)
+	poolIdleConnsDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_idle_conns", "Connections currently idle.", nil, nil)
+	poolAcquireCountDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_acquire_total", "Connections acquired from the pool.", nil, nil)
+	poolEmptyAcquireCountDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_empty_acquire_total", "Acquires that had to wait for a connection.", nil, nil)
+	poolCanceledAcquireCountDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_canceled_acquire_total", "Acquires cancelled by their context.", nil, nil)
+	poolAcquireDurationDesc = prometheus.NewDesc(
+		"gophermart_pgxpool_acquire_duration_seconds_total", "Time spent acquiring connections.", nil, nil)
+)
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolMaxConnsDesc
+	ch <- poolTotalConnsDesc
+	ch <- poolAcquiredConnsDesc
+	ch <- poolIdleConnsDesc
+	ch <- poolAcquireCountDesc
+	ch <- poolEmptyAcquireCountDesc
+	ch <- poolCanceledAcquireCountDesc
+	ch <- poolAcquireDurationDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := db.Stats(c.pool)
+	ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns))
+	ch <- prometheus.MustNewConstMetric(poolTotalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConnsDesc, prometheus.GaugeValue, float64(stats.AcquiredConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCountDesc, prometheus.CounterValue, float64(stats.AcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireCountDesc, prometheus.CounterValue, float64(stats.EmptyAcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquireCountDesc, prometheus.CounterValue, float64(stats.CanceledAcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDurationDesc, prometheus.CounterValue, stats.AcquireDuration.Seconds())
+}
+
+// OrderCounter is the part of the order repository the orders collector needs
+type OrderCounter interface {
+	CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error)
+}
+
+// RegisterOrderCounts exports the number of orders in each status.
+// The counts are queried on every scrape, bounded by timeout.
+func RegisterOrderCounts(orders OrderCounter, timeout time.Duration) {
+	Registry.MustRegister(&orderCollector{orders: orders, timeout: timeout})
+}
+
+var ordersDesc = prometheus.NewDesc(
+	"gophermart_orders", "Orders by status.", []string{"status"}, nil)
+
+var orderStatuses = []model.OrderStatus{
+	model.OrderStatusNew,
+	model.OrderStatusProcessing,
+	model.OrderStatusInvalid,
+	model.OrderStatusProcessed,
+}
+
+type orderCollector struct {
+	orders  OrderCounter
+	timeout time.Duration
+}
+
+func (c *orderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+}
+
+func (c *orderCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	counts, err := c.orders.CountByStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to count orders for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(ordersDesc, err)
+		return
+	}
+
+	// Report empty statuses too, so that rates and alerts see a zero
+	for _, status := range orderStatuses {
+		ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, float64(counts[status]), string(status))
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/riouske/gophermart/internal/response"
+)
+
+// unmatchedRoute labels requests no route matched, so that scanning for
+// random paths does not create a series per path
+const unmatchedRoute = "unmatched"
+
+// Mux is a handler that reports the pattern a request matches,
+// like http.ServeMux and router.Router
+type Mux interface {
+	http.Handler
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+// Instrument counts and times every request served by mux.
+// Requests are labelled with the mux pattern they matched, not the raw path.
+func Instrument(mux Mux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+			// The method has a label of its own
+			if _, path, found := strings.Cut(pattern, " "); found {
+				route = path
+			}
+		}
+
+		start := time.Now()
+		rw := response.Wrap(w)
+		mux.ServeHTTP(rw, r)
+
+		status := rw.Status()
+		if status == 0 {
+			// Nothing written, net/http replies 200 with an empty body
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,123 @@
+// Package metrics exposes the service's Prometheus metrics.
+// Everything is registered on Registry, which the admin listener serves.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophermart"
+
+// Registry holds every gophermart metric plus the Go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	accrualDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "request_duration_seconds",
+		Help:      "Accrual system request latency by status code, \"error\" when no response arrived.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+
+	accrualRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "rate_limited_total",
+		Help:      "Responses with status 429 from the accrual system.",
+	})
+
+	accrualQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "queue_depth",
+		Help:      "Unprocessed orders picked up by the last poll, capped at the batch size.",
+	})
+
+	accrualQueueLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "queue_lag_seconds",
+		Help:      "Age of the oldest unprocessed order at the last poll.",
+	})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts by result: success, failure or error.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		accrualDuration,
+		accrualRateLimited,
+		accrualQueueDepth,
+		accrualQueueLag,
+		logins,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveAccrualRequest records one call to the accrual system.
+// A status of 0 means the request failed before a response arrived.
+func ObserveAccrualRequest(status int, duration time.Duration) {
+	label := "error"
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	accrualDuration.WithLabelValues(label).Observe(duration.Seconds())
+
+	if status == http.StatusTooManyRequests {
+		accrualRateLimited.Inc()
+	}
+}
+
+// SetAccrualQueue records the batch found by the accrual poller
+// and how long its oldest order has been waiting
+func SetAccrualQueue(depth int, lag time.Duration) {
+	accrualQueueDepth.Set(float64(depth))
+	accrualQueueLag.Set(lag.Seconds())
+}
+
+// Login results
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginError   = "error"
+)
+
+// ObserveLogin counts a login attempt with one of the Login* results
+func ObserveLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
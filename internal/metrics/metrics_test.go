@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+func TestInstrument_LabelsByPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := Instrument(mux)
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("/api/user/orders", http.MethodPost, "202"))
+	unmatchedBefore := testutil.ToFloat64(httpRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/user/orders", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no/such/path", nil))
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/api/user/orders", http.MethodPost, "202")) - before; got != 1 {
+		t.Errorf("Expected 1 request on the orders route, got %v", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")) - unmatchedBefore; got != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", got)
+	}
+}
+
+func TestObserveAccrualRequest_CountsRateLimits(t *testing.T) {
+	before := testutil.ToFloat64(accrualRateLimited)
+
+	ObserveAccrualRequest(http.StatusOK, time.Millisecond)
+	ObserveAccrualRequest(http.StatusTooManyRequests, time.Millisecond)
+	ObserveAccrualRequest(0, time.Millisecond)
+
+	if got := testutil.ToFloat64(accrualRateLimited) - before; got != 1 {
+		t.Errorf("Expected 1 rate limited response, got %v", got)
+	}
+}
+
+type stubOrderCounter map[model.OrderStatus]int64
+
+func (s stubOrderCounter) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	return s, nil
+}
+
+func TestOrderCollector_ReportsEveryStatus(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&orderCollector{
+		orders:  stubOrderCounter{model.OrderStatusNew: 3, model.OrderStatusProcessed: 1},
+		timeout: time.Second,
+	})
+
+	expected := `
+# HELP gophermart_orders Orders by status.
+# TYPE gophermart_orders gauge
+gophermart_orders{status="INVALID"} 0
+gophermart_orders{status="NEW"} 3
+gophermart_orders{status="PROCESSED"} 1
+gophermart_orders{status="PROCESSING"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "gophermart_orders"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType identifies a domain event
+type EventType string
+
+const (
+	EventOrderStatusChanged EventType = "order.status_changed"
+	EventOrderProcessed     EventType = "order.processed"
+	EventWithdrawalMade     EventType = "withdrawal.made"
+)
+
+// DomainEvent is a state change recorded in the outbox together with the change itself
+type DomainEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	Type       EventType       `json:"type" db:"event_type"`
+	UserID     int64           `json:"user_id" db:"user_id"`
+	Payload    json.RawMessage `json:"payload" db:"payload"`
+	Attempts   int             `json:"attempts" db:"attempts"`
+	OccurredAt time.Time       `json:"occurred_at" db:"occurred_at"`
+}
+
+// Decode unmarshals the event payload into v
+func (e *DomainEvent) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// OrderEventPayload describes an order in order events
+type OrderEventPayload struct {
+	OrderID int64       `json:"order_id"`
+	Number  string      `json:"number"`
+	Status  OrderStatus `json:"status"`
+	Accrual float64     `json:"accrual"`
+}
+
+// WithdrawalEventPayload describes a withdrawal in withdrawal events
+type WithdrawalEventPayload struct {
+	WithdrawalID int64     `json:"withdrawal_id"`
+	Order        string    `json:"order"`
+	Sum          float64   `json:"sum"`
+	ProcessedAt  time.Time `json:"processed_at"`
+}
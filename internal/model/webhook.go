@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEvent identifies an event merchants can subscribe to
+type WebhookEvent string
+
+const (
+	WebhookEventOrderProcessed   WebhookEvent = "order.processed"
+	WebhookEventBalanceWithdrawn WebhookEvent = "balance.withdrawn"
+)
+
+// DeliveryStatus represents the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "PENDING"
+	DeliveryStatusDelivered DeliveryStatus = "DELIVERED"
+	DeliveryStatusDead      DeliveryStatus = "DEAD"
+)
+
+// Webhook is a subscription of an account to event notifications
+type Webhook struct {
+	ID        int64          `json:"id" db:"id"`
+	UserID    int64          `json:"-" db:"user_id"`
+	URL       string         `json:"url" db:"url"`
+	Secret    string         `json:"secret,omitempty" db:"secret"`
+	Events    []WebhookEvent `json:"events" db:"event_types"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery is a single event queued for delivery to a webhook
+type WebhookDelivery struct {
+	ID            int64           `json:"id" db:"id"`
+	WebhookID     int64           `json:"webhook_id" db:"webhook_id"`
+	Event         WebhookEvent    `json:"event" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        DeliveryStatus  `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+
+	// Target of the delivery, filled in when claimed for dispatch
+	URL    string `json:"-" db:"url"`
+	Secret string `json:"-" db:"secret"`
+}
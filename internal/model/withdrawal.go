@@ -1 +1,20 @@
 package model
+
+import (
+	"time"
+)
+
+// Withdrawal represents points spent by a user towards a new order
+type Withdrawal struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	OrderNumber string    `json:"order" db:"order_number"`
+	Sum         float64   `json:"sum" db:"sum"`
+	ProcessedAt time.Time `json:"processed_at" db:"processed_at"`
+}
+
+// Balance represents the loyalty account state of a user
+type Balance struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
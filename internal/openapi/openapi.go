@@ -0,0 +1,138 @@
+// Package openapi holds the OpenAPI 3 contract of the /api/user endpoints
+// and checks requests and responses against it.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// ErrUndocumented is returned for requests whose route is not in the contract
+var ErrUndocumented = errors.New("route is not documented")
+
+// Spec returns the OpenAPI document
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the OpenAPI document
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+}
+
+// Validator checks requests and responses against the contract. Routes are
+// looked up by the pattern the ServeMux matched, so it runs inside the mux.
+type Validator struct {
+	doc     *openapi3.T
+	options *openapi3filter.Options
+}
+
+// NewValidator loads the contract, failing when it is not a valid document
+func NewValidator() (*Validator, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		// The auth middleware has checked the token by the time requests
+		// are validated
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+		SkipSettingDefaults:   true,
+	}
+	// Keep details short, they end up in problem responses
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		if pointer := err.JSONPointer(); len(pointer) > 0 {
+			return "/" + strings.Join(pointer, "/") + " " + err.Reason
+		}
+		return err.Reason
+	})
+
+	return &Validator{doc: doc, options: options}, nil
+}
+
+// ValidateRequest checks the parameters and body of r. The body is read
+// and put back for the handler.
+func (v *Validator) ValidateRequest(r *http.Request) error {
+	input, err := v.input(r)
+	if err != nil {
+		return err
+	}
+	return openapi3filter.ValidateRequest(r.Context(), input)
+}
+
+// ValidateResponse checks a response written to r
+func (v *Validator) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	input, err := v.input(r)
+	if err != nil {
+		return err
+	}
+	return openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options:                v.options,
+	})
+}
+
+// input finds the operation of the route r matched, like
+// "GET /api/user/orders/{number}"
+func (v *Validator) input(r *http.Request) (*openapi3filter.RequestValidationInput, error) {
+	method, path, found := strings.Cut(r.Pattern, " ")
+	if !found {
+		method, path = r.Method, r.Pattern
+	}
+	path = strings.ReplaceAll(path, "...}", "}")
+
+	pathItem := v.doc.Paths.Value(path)
+	if pathItem == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrUndocumented, method, path)
+	}
+	operation := pathItem.GetOperation(method)
+	if operation == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrUndocumented, method, path)
+	}
+
+	pathParams := make(map[string]string)
+	for _, parameters := range []openapi3.Parameters{pathItem.Parameters, operation.Parameters} {
+		for _, parameter := range parameters {
+			if parameter.Value != nil && parameter.Value.In == openapi3.ParameterInPath {
+				pathParams[parameter.Value.Name] = r.PathValue(parameter.Value.Name)
+			}
+		}
+	}
+
+	return &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route: &routers.Route{
+			Spec:      v.doc,
+			Path:      path,
+			PathItem:  pathItem,
+			Method:    method,
+			Operation: operation,
+		},
+		Options: v.options,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON, got %q", ct)
+	}
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || len(doc.Paths) == 0 {
+		t.Errorf("Expected an OpenAPI 3 document with paths, got %q with %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+}
+
+func TestValidator(t *testing.T) {
+	v, err := NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests are validated against the route the mux matched
+	validate := func(pattern string, req *http.Request) error {
+		var err error
+		mux := http.NewServeMux()
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			err = v.ValidateRequest(r)
+		})
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+		return err
+	}
+
+	jsonRequest := func(method, path, body string) *http.Request {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"Valid body", "POST /api/user/balance/withdraw", jsonRequest(http.MethodPost, "/api/user/balance/withdraw", `{"order":"2377225624","sum":751}`), false},
+		{"Missing field", "POST /api/user/balance/withdraw", jsonRequest(http.MethodPost, "/api/user/balance/withdraw", `{"order":"2377225624"}`), true},
+		{"Wrong type", "POST /api/user/balance/withdraw", jsonRequest(http.MethodPost, "/api/user/balance/withdraw", `{"order":2377225624,"sum":751}`), true},
+		{"Wrong content type", "POST /api/user/orders", jsonRequest(http.MethodPost, "/api/user/orders", `12345678903`), true},
+		{"Invalid path parameter", "DELETE /api/user/webhooks/{id}", httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/abc", nil), true},
+		{"Valid path parameter", "DELETE /api/user/webhooks/{id}", httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/7", nil), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.pattern, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Undocumented route", func(t *testing.T) {
+		err := validate("GET /healthz", httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if !errors.Is(err, ErrUndocumented) {
+			t.Errorf("Expected ErrUndocumented, got %v", err)
+		}
+	})
+}
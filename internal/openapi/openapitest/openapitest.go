@@ -0,0 +1,31 @@
+// Package openapitest checks handler responses against the OpenAPI contract
+// in tests, so that handlers cannot drift from the documented API.
+package openapitest
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/openapi"
+)
+
+var loadValidator = sync.OnceValues(openapi.NewValidator)
+
+// Handler serves handler at pattern, like "POST /api/user/orders", and fails
+// t when a response breaks the contract. Requests are not validated, so
+// that tests can send the malformed ones the handler rejects itself.
+func Handler(t testing.TB, pattern string, handler http.Handler) http.Handler {
+	t.Helper()
+	validator, err := loadValidator()
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI contract: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(pattern, middleware.ValidateResponses(validator, func(r *http.Request, err error) {
+		t.Errorf("Response to %s %s breaks the OpenAPI contract: %v", r.Method, r.URL.Path, err)
+	})(handler))
+	return mux
+}
@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// Handler consumes a domain event. Delivery is at-least-once: a handler may
+// see the same event again when it or another subscriber failed, so handlers
+// must be idempotent.
+type Handler func(ctx context.Context, event *model.DomainEvent) error
+
+// Store is the persistence the dispatcher reads events from
+type Store interface {
+	ClaimBatch(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error)
+	MarkProcessed(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, final bool) error
+}
+
+// BatchStore is implemented by stores that can acknowledge a whole batch at once
+type BatchStore interface {
+	MarkProcessedMany(ctx context.Context, ids []int64) error
+}
+
+type subscriber struct {
+	name    string
+	types   map[model.EventType]bool
+	handler Handler
+}
+
+// Dispatcher delivers outbox events to registered in-process subscribers
+type Dispatcher struct {
+	store       Store
+	interval    time.Duration
+	lease       time.Duration
+	retryBase   time.Duration
+	maxAttempts int
+	batchSize   int
+
+	mu          sync.RWMutex
+	subscribers []subscriber
+}
+
+func NewDispatcher(store Store, interval, retryBase time.Duration, maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		interval:    interval,
+		lease:       time.Minute,
+		retryBase:   retryBase,
+		maxAttempts: maxAttempts,
+		batchSize:   100,
+	}
+}
+
+// Subscribe registers a handler for the given event types.
+// Without types the handler receives every event.
+func (d *Dispatcher) Subscribe(name string, handler Handler, types ...model.EventType) {
+	sub := subscriber{
+		name:    name,
+		types:   make(map[model.EventType]bool, len(types)),
+		handler: handler,
+	}
+	for _, eventType := range types {
+		sub.types[eventType] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscribers = append(d.subscribers, sub)
+}
+
+// Run dispatches events until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.Dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch handles one batch of due events
+func (d *Dispatcher) Dispatch(ctx context.Context) {
+	events, err := d.store.ClaimBatch(ctx, d.batchSize, d.lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to claim outbox events", "error", err)
+		return
+	}
+
+	// Handled events are acknowledged even when shutdown cancels ctx midway,
+	// so that they are not handled again on the next start
+	var processed []int64
+	defer func() {
+		d.markProcessed(context.WithoutCancel(ctx), processed)
+	}()
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := d.handle(ctx, event); err != nil {
+			attempts := event.Attempts + 1
+			final := attempts >= d.maxAttempts
+			if final {
+				slog.WarnContext(ctx, "Giving up on outbox event", "event_id", event.ID, "event_type", event.Type, "attempts", attempts, "error", err)
+			}
+			nextAttemptAt := time.Now().Add(d.backoff(attempts))
+			if err := d.store.MarkFailed(ctx, event.ID, attempts, nextAttemptAt, err.Error(), final); err != nil {
+				slog.ErrorContext(ctx, "Failed to record outbox event failure", "event_id", event.ID, "error", err)
+			}
+			continue
+		}
+
+		processed = append(processed, event.ID)
+	}
+}
+
+func (d *Dispatcher) markProcessed(ctx context.Context, ids []int64) {
+	if batchStore, ok := d.store.(BatchStore); ok && len(ids) > 1 {
+		if err := batchStore.MarkProcessedMany(ctx, ids); err != nil {
+			slog.ErrorContext(ctx, "Failed to mark outbox events processed", "count", len(ids), "error", err)
+		}
+		return
+	}
+
+	for _, id := range ids {
+		if err := d.store.MarkProcessed(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Failed to mark outbox event processed", "event_id", id, "error", err)
+		}
+	}
+}
+
+// handle passes the event to every interested subscriber and collects their failures
+func (d *Dispatcher) handle(ctx context.Context, event *model.DomainEvent) error {
+	d.mu.RLock()
+	subscribers := d.subscribers
+	d.mu.RUnlock()
+
+	var failures []string
+	for _, sub := range subscribers {
+		if len(sub.types) > 0 && !sub.types[event.Type] {
+			continue
+		}
+		if err := sub.handler(ctx, event); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", sub.name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("subscribers failed: %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	const maxBackoff = time.Hour
+
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,172 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// MockStore is an in-memory Store recording dispatcher outcomes
+type MockStore struct {
+	pending   []*model.DomainEvent
+	processed []int64
+	failed    map[int64]bool
+	attempts  map[int64]int
+}
+
+func NewMockStore(events ...*model.DomainEvent) *MockStore {
+	return &MockStore{
+		pending:  events,
+		failed:   make(map[int64]bool),
+		attempts: make(map[int64]int),
+	}
+}
+
+func (m *MockStore) ClaimBatch(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	claimed := m.pending
+	m.pending = nil
+	return claimed, nil
+}
+
+func (m *MockStore) MarkProcessed(ctx context.Context, id int64) error {
+	// Like a database call, acknowledging fails once ctx is done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.processed = append(m.processed, id)
+	return nil
+}
+
+func (m *MockStore) MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, final bool) error {
+	m.attempts[id] = attempts
+	m.failed[id] = final
+	return nil
+}
+
+func TestDispatcher_DeliversToInterestedSubscribers(t *testing.T) {
+	store := NewMockStore(
+		&model.DomainEvent{ID: 1, Type: model.EventOrderProcessed, UserID: 1},
+		&model.DomainEvent{ID: 2, Type: model.EventWithdrawalMade, UserID: 1},
+	)
+
+	var orders, all []int64
+	dispatcher := NewDispatcher(store, time.Second, time.Second, 3)
+	dispatcher.Subscribe("orders", func(ctx context.Context, event *model.DomainEvent) error {
+		orders = append(orders, event.ID)
+		return nil
+	}, model.EventOrderProcessed)
+	dispatcher.Subscribe("all", func(ctx context.Context, event *model.DomainEvent) error {
+		all = append(all, event.ID)
+		return nil
+	})
+
+	dispatcher.Dispatch(context.Background())
+
+	if len(orders) != 1 || orders[0] != 1 {
+		t.Errorf("orders subscriber got %v, want [1]", orders)
+	}
+	if len(all) != 2 {
+		t.Errorf("catch-all subscriber got %v, want both events", all)
+	}
+	if len(store.processed) != 2 {
+		t.Errorf("expected both events processed, got %v", store.processed)
+	}
+}
+
+func TestDispatcher_RetriesFailedEvents(t *testing.T) {
+	event := &model.DomainEvent{ID: 1, Type: model.EventOrderProcessed, UserID: 1, Attempts: 1}
+	store := NewMockStore(event)
+
+	dispatcher := NewDispatcher(store, time.Second, time.Second, 3)
+	dispatcher.Subscribe("broken", func(ctx context.Context, event *model.DomainEvent) error {
+		return errors.New("boom")
+	})
+
+	dispatcher.Dispatch(context.Background())
+
+	if len(store.processed) != 0 {
+		t.Fatalf("failed event must not be marked processed")
+	}
+	if store.attempts[1] != 2 || store.failed[1] {
+		t.Errorf("expected retry scheduled after attempt 2, got attempts=%d final=%v", store.attempts[1], store.failed[1])
+	}
+
+	// The last allowed attempt gives up on the event
+	event.Attempts = 2
+	store.pending = []*model.DomainEvent{event}
+	dispatcher.Dispatch(context.Background())
+
+	if !store.failed[1] {
+		t.Error("expected event to be marked as finally failed")
+	}
+}
+
+// MockBatchStore acknowledges processed events in batches
+type MockBatchStore struct {
+	*MockStore
+	batches [][]int64
+}
+
+func (m *MockBatchStore) MarkProcessedMany(ctx context.Context, ids []int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.batches = append(m.batches, ids)
+	return nil
+}
+
+func TestDispatcher_MarksBatchProcessed(t *testing.T) {
+	store := &MockBatchStore{MockStore: NewMockStore(
+		&model.DomainEvent{ID: 1, Type: model.EventOrderProcessed, UserID: 1},
+		&model.DomainEvent{ID: 2, Type: model.EventOrderProcessed, UserID: 1},
+		&model.DomainEvent{ID: 3, Type: model.EventWithdrawalMade, UserID: 1},
+	)}
+
+	dispatcher := NewDispatcher(store, time.Second, time.Second, 3)
+	dispatcher.Subscribe("withdrawals-broken", func(ctx context.Context, event *model.DomainEvent) error {
+		return errors.New("unavailable")
+	}, model.EventWithdrawalMade)
+
+	dispatcher.Dispatch(context.Background())
+
+	if len(store.batches) != 1 || len(store.batches[0]) != 2 {
+		t.Fatalf("expected one batch of the two handled events, got %v", store.batches)
+	}
+	if len(store.processed) != 0 {
+		t.Errorf("expected no single acknowledgements, got %v", store.processed)
+	}
+	if _, ok := store.failed[3]; !ok {
+		t.Error("expected the failed event to be recorded")
+	}
+}
+
+func TestDispatcher_AcknowledgesHandledEventsOnShutdown(t *testing.T) {
+	store := NewMockStore(
+		&model.DomainEvent{ID: 1, Type: model.EventOrderProcessed, UserID: 1},
+		&model.DomainEvent{ID: 2, Type: model.EventOrderProcessed, UserID: 1},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled []int64
+	dispatcher := NewDispatcher(store, time.Second, time.Second, 3)
+	dispatcher.Subscribe("shutdown", func(ctx context.Context, event *model.DomainEvent) error {
+		handled = append(handled, event.ID)
+		// Shutdown begins while the batch is being handled
+		cancel()
+		return nil
+	})
+
+	dispatcher.Dispatch(ctx)
+
+	if len(handled) != 1 {
+		t.Fatalf("expected the batch to stop after cancellation, handled %v", handled)
+	}
+	if len(store.processed) != 1 || store.processed[0] != 1 {
+		t.Errorf("expected the handled event to be acknowledged, got %v", store.processed)
+	}
+}
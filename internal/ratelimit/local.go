@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often LocalStore forgets full buckets
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// LocalStore keeps buckets in process memory. Each instance of the service
+// enforces the limits on its own.
+type LocalStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLocalStore() *LocalStore {
+	return &LocalStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *LocalStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	available := limit.Burst()
+	b, ok := s.buckets[key]
+	if ok {
+		available = min(limit.Burst(), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate())
+	} else {
+		b = &bucket{}
+		s.buckets[key] = b
+	}
+
+	result := NewResult(limit, available)
+	if result.Allowed {
+		available--
+	}
+	b.tokens = available
+	b.updated = now
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// sweep drops buckets that have refilled, as a missing bucket is a full one
+func (s *LocalStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package ratelimit implements token bucket rate limiting. A bucket holds up
+// to Limit.Requests tokens and refills at Requests per Limit.Per; every
+// request takes one token and is rejected when none is left.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Per, in bursts of up to Requests
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Rate is the refill rate in tokens per second
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Burst is the bucket capacity
+func (l Limit) Burst() float64 {
+	return float64(l.Requests)
+}
+
+// String formats the limit the way ParseLimit reads it
+func (l Limit) String() string {
+	unit := l.Per.String()
+	switch l.Per {
+	case time.Second:
+		unit = "s"
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, unit)
+}
+
+// refill is how long the bucket takes to gain tokens
+func (l Limit) refill(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate() * float64(time.Second))
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// RetryAfter is how long until a token is available, zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// NewResult takes a token from a bucket holding available tokens
+func NewResult(limit Limit, available float64) Result {
+	if available >= 1 {
+		left := available - 1
+		return Result{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: int(math.Floor(left)),
+			Reset:     limit.refill(limit.Burst() - left),
+		}
+	}
+	return Result{
+		Limit:      limit,
+		RetryAfter: limit.refill(1 - available),
+		Reset:      limit.refill(limit.Burst() - available),
+	}
+}
+
+// Store keeps the buckets. Stores shared between instances, like the
+// PostgreSQL one, enforce the limit across a whole deployment.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Pruner is implemented by stores that need idle buckets removed
+type Pruner interface {
+	Prune(ctx context.Context, idle time.Duration) error
+}
+
+// RunPruner removes buckets idle for longer than idle every interval,
+// until ctx is cancelled
+func RunPruner(ctx context.Context, pruner Pruner, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pruner.Prune(ctx, idle); err != nil {
+				slog.ErrorContext(ctx, "Failed to prune rate limit buckets", "error", err)
+			}
+		}
+	}
+}
+
+// DefaultRoute is the key of the limit applied to routes without one
+const DefaultRoute = "*"
+
+// Limits holds the limit of every route pattern
+type Limits struct {
+	routes map[string]Limit
+}
+
+// ParseLimits reads a comma separated list of pattern=limit pairs, the
+// pattern being a route like "POST /api/user/orders" or "*" for every other
+// route, and the limit a count per unit, like 10/s, 100/m, 1000/h or 5/30s:
+//
+//	*=100/s,POST /api/user/orders=20/s
+func ParseLimits(s string) (*Limits, error) {
+	limits := &Limits{routes: make(map[string]Limit)}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("rate limit %q: expected pattern=limit", entry)
+		}
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", entry, err)
+		}
+		limits.routes[strings.TrimSpace(pattern)] = limit
+	}
+	return limits, nil
+}
+
+// ParseLimit reads a limit like 10/s
+func ParseLimit(s string) (Limit, error) {
+	count, unit, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("expected requests/unit, got %q", s)
+	}
+
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid request count %q", count)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(unit)
+		if err != nil || per <= 0 {
+			return Limit{}, fmt.Errorf("invalid unit %q", unit)
+		}
+	}
+
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// For returns the limit of a route pattern, falling back to the default.
+// It reports false when the route is not limited.
+func (l *Limits) For(pattern string) (Limit, bool) {
+	if limit, ok := l.routes[pattern]; ok {
+		return limit, true
+	}
+	limit, ok := l.routes[DefaultRoute]
+	return limit, ok
+}
+
+// Longest is the longest period of any limit, after which an untouched
+// bucket is full again and can be forgotten
+func (l *Limits) Longest() time.Duration {
+	var longest time.Duration
+	for _, limit := range l.routes {
+		longest = max(longest, limit.Per)
+	}
+	return longest
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("*=100/s, POST /api/user/orders=20/m,POST /api/user/login=5/30s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected Limit
+	}{
+		{pattern: "POST /api/user/orders", expected: Limit{Requests: 20, Per: time.Minute}},
+		{pattern: "POST /api/user/login", expected: Limit{Requests: 5, Per: 30 * time.Second}},
+		{pattern: "GET /api/user/balance", expected: Limit{Requests: 100, Per: time.Second}},
+	}
+	for _, tt := range tests {
+		got, _ := limits.For(tt.pattern)
+		if got != tt.expected {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.pattern, got)
+		}
+		if parsed, err := ParseLimit(got.String()); err != nil || parsed != got {
+			t.Errorf("Expected %v to parse back, got %v (%v)", got, parsed, err)
+		}
+	}
+
+	if longest := limits.Longest(); longest != time.Minute {
+		t.Errorf("Expected the longest period to be a minute, got %s", longest)
+	}
+
+	for _, invalid := range []string{"POST /api/user/orders", "*=10", "*=0/s", "*=10/day"} {
+		if _, err := ParseLimits(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+
+	if _, ok := (&Limits{}).For("GET /healthz"); ok {
+		t.Error("Expected no limit without a default")
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewLocalStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Requests: 2, Per: time.Second}
+	take := func() Result {
+		t.Helper()
+		result, err := store.Take(context.Background(), "client", limit)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return result
+	}
+
+	// The bucket starts full and allows a burst
+	if result := take(); !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("Expected first request allowed with 1 left, got %+v", result)
+	}
+	if result := take(); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Expected second request allowed with 0 left, got %+v", result)
+	}
+
+	result := take()
+	if result.Allowed {
+		t.Fatal("Expected third request to be rejected")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected to retry after 500ms, got %s", result.RetryAfter)
+	}
+	if result.Reset != time.Second {
+		t.Errorf("Expected the bucket to be full in 1s, got %s", result.Reset)
+	}
+
+	// One token refills every 500ms
+	now = now.Add(500 * time.Millisecond)
+	if result := take(); !result.Allowed {
+		t.Error("Expected a request to be allowed after refill")
+	}
+
+	// Other clients have buckets of their own
+	if result, _ := store.Take(context.Background(), "other", limit); !result.Allowed {
+		t.Error("Expected another client to be allowed")
+	}
+
+	// Full buckets are forgotten on the next sweep
+	now = now.Add(sweepInterval)
+	take()
+	if len(store.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, got %d buckets", len(store.buckets))
+	}
+}
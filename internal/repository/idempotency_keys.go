@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/riouske/gophermart/internal/idempotency"
+)
+
+// reserveKeyQuery claims a free key, or takes over an expired one or one
+// whose request never completed within its lease. The token changes hands
+// with the key, so that the request that lost it can no longer touch it.
+const reserveKeyQuery = `INSERT INTO idempotency_keys (key, fingerprint, locked_until, expires_at, token)
+              VALUES ($1, $2, NOW() + make_interval(secs => $4), NOW() + make_interval(secs => $3), $5)
+              ON CONFLICT (key) DO UPDATE
+              SET fingerprint = EXCLUDED.fingerprint,
+                  token = EXCLUDED.token,
+                  response = NULL,
+                  created_at = NOW(),
+                  locked_until = EXCLUDED.locked_until,
+                  expires_at = EXCLUDED.expires_at
+              WHERE idempotency_keys.expires_at <= NOW()
+                 OR (idempotency_keys.response IS NULL AND idempotency_keys.locked_until <= NOW())
+              RETURNING key`
+
+const getKeyQuery = `SELECT fingerprint, response FROM idempotency_keys
+              WHERE key = $1 AND expires_at > NOW()`
+
+const completeKeyQuery = `UPDATE idempotency_keys SET response = $3::jsonb WHERE key = $1 AND token = $2`
+
+const releaseKeyQuery = `DELETE FROM idempotency_keys WHERE key = $1 AND token = $2`
+
+const pruneKeysQuery = `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`
+
+// reserveAttempts bounds the retries when the key is released or expires
+// between the failed claim and the lookup of its record
+const reserveAttempts = 3
+
+var errKeyContended = errors.New("idempotency key changed hands while reserving it")
+
+// IdempotencyRepository is the idempotency.Store shared by every instance
+// of the service through PostgreSQL
+type IdempotencyRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+func NewIdempotencyRepository(db *sql.DB, queryTimeout time.Duration) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key, token, fingerprint string, ttl, lease time.Duration) (*idempotency.Record, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		var reserved string
+		err := r.db.QueryRowContext(ctx, reserveKeyQuery, key, fingerprint, ttl.Seconds(), lease.Seconds(), token).Scan(&reserved)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		record := &idempotency.Record{}
+		var response []byte
+		err = r.db.QueryRowContext(ctx, getKeyQuery, key).Scan(&record.Fingerprint, &response)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		return record, decodeIdempotentResponse(record, response)
+	}
+
+	return nil, errKeyContended
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key, token string, response *idempotency.Response) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotent response: %w", err)
+	}
+
+	result, err := r.db.ExecContext(ctx, completeKeyQuery, key, token, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if rows == 0 {
+		return idempotency.ErrReservationLost
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, releaseKeyQuery, key, token); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes expired keys
+func (r *IdempotencyRepository) Prune(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, pruneKeysQuery); err != nil {
+		return fmt.Errorf("failed to prune idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// decodeIdempotentResponse fills in the stored response, absent while the
+// first request is in flight
+func decodeIdempotentResponse(record *idempotency.Record, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	record.Response = &idempotency.Response{}
+	if err := json.Unmarshal(data, record.Response); err != nil {
+		return fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+	return nil
+}
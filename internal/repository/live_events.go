@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/riouske/gophermart/internal/events"
+)
+
+// liveEventsChannel is the PostgreSQL channel live events are relayed on
+const liveEventsChannel = "live_events"
+
+// liveEventMessage is a live event as it travels between instances.
+// NOTIFY payloads are limited to 8000 bytes, which live events stay far below.
+type liveEventMessage struct {
+	Type   events.Type     `json:"type"`
+	UserID int64           `json:"user_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// LiveEventRepository is the events.Broadcaster of instances sharing a
+// PostgreSQL database. Events are relayed with NOTIFY to every instance
+// running Listen, which publishes them on its own hub. Like the hub itself
+// it is best effort: events sent while a listener reconnects are lost.
+type LiveEventRepository struct {
+	db      DBTX
+	dsn     string
+	timeout time.Duration
+}
+
+// NewLiveEventRepository broadcasts through db and listens with a dedicated
+// connection to dsn, since a listening session cannot be shared with a pool
+func NewLiveEventRepository(db *sql.DB, dsn string, queryTimeout time.Duration) *LiveEventRepository {
+	return &LiveEventRepository{db: db, dsn: dsn, timeout: queryTimeout}
+}
+
+// Broadcast sends the event to the listeners of every instance, this one included
+func (r *LiveEventRepository) Broadcast(ctx context.Context, event events.Event) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode live event: %w", err)
+	}
+	payload, err := json.Marshal(liveEventMessage{Type: event.Type, UserID: event.UserID, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode live event: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, liveEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to broadcast live event: %w", err)
+	}
+	return nil
+}
+
+// Listen publishes the events broadcast by any instance on hub until ctx is
+// done, reconnecting with backoff when the connection fails
+func (r *LiveEventRepository) Listen(ctx context.Context, hub *events.Hub) {
+	backoff := time.Second
+	for {
+		err := r.listen(ctx, hub, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Live event listener failed, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// listen runs one listening session, calling connected once it is set up
+func (r *LiveEventRepository) listen(ctx context.Context, hub *events.Hub, connected func()) error {
+	conn, err := pgx.Connect(ctx, r.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `LISTEN `+liveEventsChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		var message liveEventMessage
+		if err := json.Unmarshal([]byte(notification.Payload), &message); err != nil {
+			slog.WarnContext(ctx, "Dropping malformed live event", "error", err)
+			continue
+		}
+		hub.Publish(events.Event{Type: message.Type, UserID: message.UserID, Data: message.Data})
+	}
+}
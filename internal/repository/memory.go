@@ -0,0 +1,598 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// MemoryStore keeps all data of the in-memory repositories. It is meant for
+// tests and local development; nothing survives a restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state *memoryState
+}
+
+type memoryState struct {
+	users       map[int64]model.User
+	orders      map[int64]model.Order
+	withdrawals map[int64]model.Withdrawal
+	events      map[int64]memoryEvent
+
+	// nextPollAt holds the claims of the accrual poller; orders without
+	// one are due
+	nextPollAt map[int64]time.Time
+
+	lastUserID       int64
+	lastOrderID      int64
+	lastWithdrawalID int64
+	lastEventID      int64
+}
+
+type memoryEvent struct {
+	event         model.DomainEvent
+	status        string
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		state: &memoryState{
+			users:       make(map[int64]model.User),
+			orders:      make(map[int64]model.Order),
+			withdrawals: make(map[int64]model.Withdrawal),
+			events:      make(map[int64]memoryEvent),
+			nextPollAt:  make(map[int64]time.Time),
+		},
+	}
+}
+
+// memoryTxKey marks the context of a unit of work with the store it locked
+type memoryTxKey struct{}
+
+// lock locks the store unless the caller runs inside WithinTx,
+// which already holds the lock for the whole unit of work. Repositories
+// outside the unit of work would wait for that lock forever, so reaching
+// for them from inside it panics instead of deadlocking.
+func (s *MemoryStore) lock(ctx context.Context, inTx bool) func() {
+	if inTx {
+		return func() {}
+	}
+	if ctx.Value(memoryTxKey{}) == s {
+		panic("repository: memory store used outside the repositories of the transaction holding it")
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (st *memoryState) clone() *memoryState {
+	clone := *st
+	clone.users = maps.Clone(st.users)
+	clone.orders = maps.Clone(st.orders)
+	clone.withdrawals = maps.Clone(st.withdrawals)
+	clone.events = maps.Clone(st.events)
+	clone.nextPollAt = maps.Clone(st.nextPollAt)
+	return &clone
+}
+
+// orderNumbers returns the set of numbers already uploaded
+func (st *memoryState) orderNumbers() map[string]bool {
+	numbers := make(map[string]bool, len(st.orders))
+	for _, order := range st.orders {
+		numbers[order.Number] = true
+	}
+	return numbers
+}
+
+// balance sums the processed accruals and withdrawals of a user
+func (st *memoryState) balance(userID int64) *model.Balance {
+	var accrued, withdrawn float64
+	for _, order := range st.orders {
+		if order.UserID == userID && order.Status == model.OrderStatusProcessed {
+			accrued += order.Accrual
+		}
+	}
+	for _, withdrawal := range st.withdrawals {
+		if withdrawal.UserID == userID {
+			withdrawn += withdrawal.Sum
+		}
+	}
+
+	return &model.Balance{
+		Current:   accrued - withdrawn,
+		Withdrawn: withdrawn,
+	}
+}
+
+func (st *memoryState) appendEvent(eventType model.EventType, userID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	st.lastEventID++
+	now := time.Now()
+	st.events[st.lastEventID] = memoryEvent{
+		event: model.DomainEvent{
+			ID:         st.lastEventID,
+			Type:       eventType,
+			UserID:     userID,
+			Payload:    data,
+			OccurredAt: now,
+		},
+		status:        outboxStatusPending,
+		nextAttemptAt: now,
+	}
+
+	return nil
+}
+
+// MemoryTxManager is the in-memory Transactor. Units of work run one at a
+// time and their changes are discarded when fn fails. They cannot nest, and
+// fn must only use the repositories it is given.
+type MemoryTxManager struct {
+	store *MemoryStore
+}
+
+func NewMemoryTxManager(store *MemoryStore) *MemoryTxManager {
+	return &MemoryTxManager{store: store}
+}
+
+func (m *MemoryTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	if ctx.Value(memoryTxKey{}) == m.store {
+		panic("repository: memory transaction started inside another one")
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	ctx = context.WithValue(ctx, memoryTxKey{}, m.store)
+
+	snapshot := m.store.state.clone()
+	repos := &Repositories{
+		Users:       &UserRepository{Impl: &MemoryUserRepository{store: m.store, inTx: true}},
+		Orders:      &OrderRepository{Impl: &MemoryOrderRepository{store: m.store, inTx: true}},
+		Withdrawals: &WithdrawalRepository{Impl: &MemoryWithdrawalRepository{store: m.store, inTx: true}},
+	}
+
+	if err := fn(ctx, repos); err != nil {
+		m.store.state = snapshot
+		return err
+	}
+
+	return nil
+}
+
+// MemoryUserRepository is the in-memory implementation of UserRepositoryInterface
+type MemoryUserRepository struct {
+	store *MemoryStore
+	inTx  bool
+}
+
+func NewMemoryUserRepository(store *MemoryStore) *UserRepository {
+	return &UserRepository{Impl: &MemoryUserRepository{store: store}}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *model.User) error {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	for _, existing := range st.users {
+		// Logins are unique regardless of case, like the PostgreSQL index
+		if strings.EqualFold(existing.Login, user.Login) {
+			return ErrUserExists
+		}
+	}
+
+	now := time.Now()
+	st.lastUserID++
+	user.ID = st.lastUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	st.users[user.ID] = *user
+
+	return nil
+}
+
+func (r *MemoryUserRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	for _, user := range r.store.state.users {
+		if strings.EqualFold(user.Login, login) && user.DeletedAt == nil {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	user, ok := r.store.state.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+// MemoryOrderRepository is the in-memory implementation of OrderRepositoryInterface
+type MemoryOrderRepository struct {
+	store *MemoryStore
+	inTx  bool
+}
+
+func NewMemoryOrderRepository(store *MemoryStore) *OrderRepository {
+	return &OrderRepository{Impl: &MemoryOrderRepository{store: store}}
+}
+
+func (r *MemoryOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	for _, existing := range st.orders {
+		if existing.Number != order.Number {
+			continue
+		}
+		if existing.UserID == order.UserID {
+			return ErrOrderExists
+		}
+		return ErrOrderExistsForUser
+	}
+
+	st.lastOrderID++
+	order.ID = st.lastOrderID
+	order.UploadedAt = time.Now()
+	st.orders[order.ID] = *order
+
+	return nil
+}
+
+func (r *MemoryOrderRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	taken := st.orderNumbers()
+	now := time.Now()
+	created := 0
+	for _, order := range orders {
+		order.UploadedAt = now
+		if taken[order.Number] {
+			continue
+		}
+
+		st.lastOrderID++
+		order.ID = st.lastOrderID
+		st.orders[order.ID] = *order
+		taken[order.Number] = true
+		created++
+
+		if err := st.appendEvent(model.EventOrderStatusChanged, order.UserID, newOrderEventPayload(order)); err != nil {
+			return 0, err
+		}
+	}
+
+	return created, nil
+}
+
+func (r *MemoryOrderRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	// Nothing is stored unless every number is free, like the COPY in PostgreSQL
+	st := r.store.state
+	taken := st.orderNumbers()
+	for _, order := range orders {
+		if taken[order.Number] {
+			return 0, fmt.Errorf("failed to import order %s: number is already taken", order.Number)
+		}
+		taken[order.Number] = true
+	}
+
+	now := time.Now()
+	for _, order := range orders {
+		if order.UploadedAt.IsZero() {
+			order.UploadedAt = now
+		}
+		st.lastOrderID++
+		order.ID = st.lastOrderID
+		st.orders[order.ID] = *order
+
+		for _, eventType := range importedOrderEvents(order) {
+			if err := st.appendEvent(eventType, order.UserID, newOrderEventPayload(order)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return int64(len(orders)), nil
+}
+
+func (r *MemoryOrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	order, ok := r.store.state.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	return &order, nil
+}
+
+func (r *MemoryOrderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	for _, order := range r.store.state.orders {
+		if order.Number == number {
+			return &order, nil
+		}
+	}
+
+	return nil, ErrOrderNotFound
+}
+
+func (r *MemoryOrderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	var orders []*model.Order
+	for _, order := range r.store.state.orders {
+		if order.UserID == userID {
+			orders = append(orders, &order)
+		}
+	}
+
+	// Newest first, matching the PostgreSQL implementation
+	sort.Slice(orders, func(i, j int) bool {
+		return uploadedBefore(orders[j], orders[i])
+	})
+
+	return orders, nil
+}
+
+func (r *MemoryOrderRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	now := time.Now()
+	var orders []*model.Order
+	for _, order := range st.orders {
+		if order.Status != model.OrderStatusNew && order.Status != model.OrderStatusProcessing {
+			continue
+		}
+		if next, ok := st.nextPollAt[order.ID]; ok && next.After(now) {
+			continue
+		}
+		orders = append(orders, &order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return uploadedBefore(orders[i], orders[j])
+	})
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	for _, order := range orders {
+		st.nextPollAt[order.ID] = now.Add(lease)
+	}
+
+	return orders, nil
+}
+
+func (r *MemoryOrderRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	counts := make(map[model.OrderStatus]int64)
+	for _, order := range r.store.state.orders {
+		counts[order.Status]++
+	}
+
+	return counts, nil
+}
+
+func (r *MemoryOrderRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	order, ok := st.orders[id]
+	if !ok {
+		return ErrOrderNotFound
+	}
+
+	order.Status = status
+	st.orders[id] = order
+
+	payload := model.OrderEventPayload{OrderID: id, Number: order.Number, Status: status, Accrual: order.Accrual}
+	return st.appendEvent(model.EventOrderStatusChanged, order.UserID, payload)
+}
+
+func (r *MemoryOrderRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	order, ok := st.orders[id]
+	if !ok {
+		return ErrOrderNotFound
+	}
+
+	order.Accrual = accrual
+	order.Status = status
+	st.orders[id] = order
+
+	payload := model.OrderEventPayload{OrderID: id, Number: order.Number, Status: status, Accrual: accrual}
+	if err := st.appendEvent(model.EventOrderStatusChanged, order.UserID, payload); err != nil {
+		return err
+	}
+
+	if status == model.OrderStatusProcessed {
+		return st.appendEvent(model.EventOrderProcessed, order.UserID, payload)
+	}
+
+	return nil
+}
+
+// uploadedBefore orders by upload time, breaking ties by ID
+func uploadedBefore(a, b *model.Order) bool {
+	if a.UploadedAt.Equal(b.UploadedAt) {
+		return a.ID < b.ID
+	}
+	return a.UploadedAt.Before(b.UploadedAt)
+}
+
+// MemoryWithdrawalRepository is the in-memory implementation of WithdrawalRepositoryInterface
+type MemoryWithdrawalRepository struct {
+	store *MemoryStore
+	inTx  bool
+}
+
+func NewMemoryWithdrawalRepository(store *MemoryStore) *WithdrawalRepository {
+	return &WithdrawalRepository{Impl: &MemoryWithdrawalRepository{store: store}}
+}
+
+func (r *MemoryWithdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	st := r.store.state
+	if _, ok := st.users[withdrawal.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	for _, existing := range st.withdrawals {
+		if existing.OrderNumber == withdrawal.OrderNumber {
+			return ErrWithdrawalExists
+		}
+	}
+	if st.balance(withdrawal.UserID).Current < withdrawal.Sum {
+		return ErrInsufficientFunds
+	}
+
+	st.lastWithdrawalID++
+	withdrawal.ID = st.lastWithdrawalID
+	withdrawal.ProcessedAt = time.Now()
+	st.withdrawals[withdrawal.ID] = *withdrawal
+
+	payload := model.WithdrawalEventPayload{
+		WithdrawalID: withdrawal.ID,
+		Order:        withdrawal.OrderNumber,
+		Sum:          withdrawal.Sum,
+		ProcessedAt:  withdrawal.ProcessedAt,
+	}
+	return st.appendEvent(model.EventWithdrawalMade, withdrawal.UserID, payload)
+}
+
+func (r *MemoryWithdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	var withdrawals []*model.Withdrawal
+	for _, withdrawal := range r.store.state.withdrawals {
+		if withdrawal.UserID == userID {
+			withdrawals = append(withdrawals, &withdrawal)
+		}
+	}
+
+	sort.Slice(withdrawals, func(i, j int) bool {
+		if withdrawals[i].ProcessedAt.Equal(withdrawals[j].ProcessedAt) {
+			return withdrawals[i].ID > withdrawals[j].ID
+		}
+		return withdrawals[i].ProcessedAt.After(withdrawals[j].ProcessedAt)
+	})
+
+	return withdrawals, nil
+}
+
+func (r *MemoryWithdrawalRepository) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	unlock := r.store.lock(ctx, r.inTx)
+	defer unlock()
+
+	return r.store.state.balance(userID), nil
+}
+
+// MemoryOutboxRepository serves the events recorded by the in-memory
+// repositories to the outbox dispatcher
+type MemoryOutboxRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryOutboxRepository(store *MemoryStore) *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{store: store}
+}
+
+// ClaimBatch returns due events in occurrence order and pushes their next attempt out by the lease
+func (r *MemoryOutboxRepository) ClaimBatch(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	unlock := r.store.lock(ctx, false)
+	defer unlock()
+
+	now := time.Now()
+	var ids []int64
+	for id, stored := range r.store.state.events {
+		if stored.status == outboxStatusPending && !stored.nextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	events := make([]*model.DomainEvent, 0, len(ids))
+	for _, id := range ids {
+		stored := r.store.state.events[id]
+		stored.nextAttemptAt = now.Add(lease)
+		r.store.state.events[id] = stored
+
+		event := stored.event
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// MarkProcessed drops the event; unlike PostgreSQL there is no history to keep
+func (r *MemoryOutboxRepository) MarkProcessed(ctx context.Context, id int64) error {
+	unlock := r.store.lock(ctx, false)
+	defer unlock()
+
+	delete(r.store.state.events, id)
+	return nil
+}
+
+// MarkFailed records a failed attempt and either schedules a retry or gives up on the event
+func (r *MemoryOutboxRepository) MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, final bool) error {
+	unlock := r.store.lock(ctx, false)
+	defer unlock()
+
+	stored, ok := r.store.state.events[id]
+	if !ok {
+		return nil
+	}
+
+	stored.event.Attempts = attempts
+	stored.nextAttemptAt = nextAttemptAt
+	stored.lastError = lastError
+	if final {
+		stored.status = outboxStatusFailed
+	}
+	r.store.state.events[id] = stored
+
+	return nil
+}
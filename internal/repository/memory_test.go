@@ -0,0 +1,88 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/outbox"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/repository/repotest"
+)
+
+func newMemoryRepositories(t *testing.T) *repository.Repositories {
+	repos, _ := newMemoryRepositoriesWithOutbox(t)
+	return repos
+}
+
+func newMemoryRepositoriesWithOutbox(t *testing.T) (*repository.Repositories, outbox.Store) {
+	store := repository.NewMemoryStore()
+	return &repository.Repositories{
+		Users:       repository.NewMemoryUserRepository(store),
+		Orders:      repository.NewMemoryOrderRepository(store),
+		Withdrawals: repository.NewMemoryWithdrawalRepository(store),
+	}, repository.NewMemoryOutboxRepository(store)
+}
+
+func TestMemoryOrderRepository(t *testing.T) {
+	repotest.RunOrderRepositoryTests(t, newMemoryRepositories)
+}
+
+func TestMemoryOrderRepository_Events(t *testing.T) {
+	repotest.RunOrderEventTests(t, newMemoryRepositoriesWithOutbox)
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, newMemoryRepositories)
+}
+
+func TestMemoryWithdrawalRepository(t *testing.T) {
+	repotest.RunWithdrawalRepositoryTests(t, newMemoryRepositories)
+}
+
+func TestMemoryTxManager_RefusesOutsideRepositories(t *testing.T) {
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	txManager := repository.NewMemoryTxManager(store)
+
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, repos *repository.Repositories) error
+	}{
+		{
+			name: "Repository outside the transaction",
+			fn: func(ctx context.Context, repos *repository.Repositories) error {
+				_, err := users.GetByID(ctx, 1)
+				return err
+			},
+		},
+		{
+			name: "Nested transaction",
+			fn: func(ctx context.Context, repos *repository.Repositories) error {
+				return txManager.WithinTx(ctx, func(context.Context, *repository.Repositories) error { return nil })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected a panic instead of a deadlock")
+				}
+			}()
+			txManager.WithinTx(context.Background(), tt.fn)
+		})
+	}
+
+	// The store is unlocked again and the repositories of a transaction work
+	err := txManager.WithinTx(context.Background(), func(ctx context.Context, repos *repository.Repositories) error {
+		return repos.Users.Create(ctx, &model.User{Login: "tx", Password: "hash"})
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if _, err := users.GetByLogin(context.Background(), "tx"); err != nil {
+		t.Errorf("Expected the user created in the transaction, got %v", err)
+	}
+}
@@ -1,14 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
-
 	"github.com/riouske/gophermart/internal/model"
 )
 
@@ -19,12 +18,16 @@ var (
 )
 
 type OrderRepositoryInterface interface {
-	Create(order *model.Order) error
-	GetByID(id int64) (*model.Order, error)
-	GetByNumber(number string) (*model.Order, error)
-	GetByUserID(userID int64) ([]*model.Order, error)
-	UpdateStatus(id int64, status model.OrderStatus) error
-	UpdateAccrual(id int64, accrual float64, status model.OrderStatus) error
+	Create(ctx context.Context, order *model.Order) error
+	CreateMany(ctx context.Context, orders []*model.Order) (int, error)
+	Import(ctx context.Context, orders []*model.Order) (int64, error)
+	GetByID(ctx context.Context, id int64) (*model.Order, error)
+	GetByNumber(ctx context.Context, number string) (*model.Order, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error)
+	ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error)
+	CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error)
+	UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error
+	UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error
 }
 
 type OrderRepository struct {
@@ -32,56 +35,84 @@ type OrderRepository struct {
 	db   *sql.DB
 }
 
-func NewOrderRepository(db *sql.DB) *OrderRepository {
+func NewOrderRepository(db *sql.DB, queryTimeout time.Duration) *OrderRepository {
 	repo := &OrderRepository{db: db}
-	repo.Impl = &PostgresOrderRepository{db: db}
+	repo.Impl = &PostgresOrderRepository{db: db, timeout: queryTimeout}
 	return repo
 }
 
 // Create delegates to the implementation
-func (r *OrderRepository) Create(order *model.Order) error {
-	return r.Impl.Create(order)
+func (r *OrderRepository) Create(ctx context.Context, order *model.Order) error {
+	return r.Impl.Create(ctx, order)
+}
+
+// CreateMany delegates to the implementation
+func (r *OrderRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	return r.Impl.CreateMany(ctx, orders)
+}
+
+// Import delegates to the implementation
+func (r *OrderRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	return r.Impl.Import(ctx, orders)
 }
 
 // GetByID delegates to the implementation
-func (r *OrderRepository) GetByID(id int64) (*model.Order, error) {
-	return r.Impl.GetByID(id)
+func (r *OrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
+	return r.Impl.GetByID(ctx, id)
 }
 
 // GetByNumber delegates to the implementation
-func (r *OrderRepository) GetByNumber(number string) (*model.Order, error) {
-	return r.Impl.GetByNumber(number)
+func (r *OrderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
+	return r.Impl.GetByNumber(ctx, number)
 }
 
 // GetByUserID delegates to the implementation
-func (r *OrderRepository) GetByUserID(userID int64) ([]*model.Order, error) {
-	return r.Impl.GetByUserID(userID)
+func (r *OrderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+	return r.Impl.GetByUserID(ctx, userID)
+}
+
+// ClaimUnprocessed delegates to the implementation
+func (r *OrderRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	return r.Impl.ClaimUnprocessed(ctx, limit, lease)
+}
+
+// CountByStatus delegates to the implementation
+func (r *OrderRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	return r.Impl.CountByStatus(ctx)
 }
 
 // UpdateStatus delegates to the implementation
-func (r *OrderRepository) UpdateStatus(id int64, status model.OrderStatus) error {
-	return r.Impl.UpdateStatus(id, status)
+func (r *OrderRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
+	return r.Impl.UpdateStatus(ctx, id, status)
 }
 
 // UpdateAccrual delegates to the implementation
-func (r *OrderRepository) UpdateAccrual(id int64, accrual float64, status model.OrderStatus) error {
-	return r.Impl.UpdateAccrual(id, accrual, status)
+func (r *OrderRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
+	return r.Impl.UpdateAccrual(ctx, id, accrual, status)
 }
 
 // PostgresOrderRepository is the PostgreSQL implementation of OrderRepositoryInterface
 type PostgresOrderRepository struct {
-	db *sql.DB
+	db      DBTX
+	timeout time.Duration
 }
 
-// Create adds a new order to the database
-func (r *PostgresOrderRepository) Create(order *model.Order) error {
+// Create adds a new order to the database. A number that is already taken
+// is reported without failing the statement, so Create is safe to call
+// inside a transaction.
+func (r *PostgresOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `INSERT INTO orders (user_id, number, status, uploaded_at) 
               VALUES ($1, $2, $3, $4) 
+              ON CONFLICT (number) DO NOTHING
               RETURNING id`
 
 	order.UploadedAt = time.Now()
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		order.UserID,
 		order.Number,
@@ -89,30 +120,112 @@ func (r *PostgresOrderRepository) Create(order *model.Order) error {
 		order.UploadedAt,
 	).Scan(&order.ID)
 
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-			// Check if the order exists for the same user
-			existingOrder, err := r.GetByNumber(order.Number)
-			if err == nil && existingOrder.UserID == order.UserID {
-				return ErrOrderExists
-			}
-			return ErrOrderExistsForUser
+	if errors.Is(err, sql.ErrNoRows) {
+		// Check if the order exists for the same user
+		var ownerID int64
+		err = r.db.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE number = $1`, order.Number).Scan(&ownerID)
+		if err != nil {
+			return fmt.Errorf("failed to get existing order: %w", err)
 		}
+		if ownerID == order.UserID {
+			return ErrOrderExists
+		}
+		return ErrOrderExistsForUser
+	}
+	if err != nil {
 		return fmt.Errorf("failed to create order: %w", err)
 	}
 
 	return nil
 }
 
+// CreateMany uploads orders in one transaction. Numbers that are already
+// taken are skipped and keep a zero ID; the number of new orders is returned.
+// Every new order is announced with a status change event.
+func (r *PostgresOrderRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO orders (user_id, number, status, uploaded_at)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (number) DO NOTHING
+              RETURNING id`
+
+	now := time.Now()
+	created := 0
+	err := runInTx(ctx, r.db, func(tx DBTX) error {
+		for _, order := range orders {
+			order.UploadedAt = now
+			err := tx.QueryRowContext(ctx, query, order.UserID, order.Number, order.Status, order.UploadedAt).Scan(&order.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to create order %s: %w", order.Number, err)
+			}
+			created++
+
+			if err := appendEvent(ctx, tx, model.EventOrderStatusChanged, order.UserID, newOrderEventPayload(order)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// Import loads orders keeping their status, accrual and upload time, and
+// records the events the accrual poller would have. Any conflicting number
+// aborts the whole import.
+func (r *PostgresOrderRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO orders (user_id, number, status, accrual, uploaded_at)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id`
+
+	now := time.Now()
+	err := runInTx(ctx, r.db, func(tx DBTX) error {
+		for _, order := range orders {
+			if order.UploadedAt.IsZero() {
+				order.UploadedAt = now
+			}
+			err := tx.QueryRowContext(ctx, query, order.UserID, order.Number, order.Status, order.Accrual, order.UploadedAt).Scan(&order.ID)
+			if err != nil {
+				return fmt.Errorf("failed to import order %s: %w", order.Number, err)
+			}
+
+			for _, eventType := range importedOrderEvents(order) {
+				if err := appendEvent(ctx, tx, eventType, order.UserID, newOrderEventPayload(order)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(orders)), nil
+}
+
 // GetByID retrieves an order by its ID
-func (r *PostgresOrderRepository) GetByID(id int64) (*model.Order, error) {
+func (r *PostgresOrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `SELECT id, user_id, number, status, accrual, uploaded_at 
               FROM orders 
               WHERE id = $1`
 
 	order := &model.Order{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&order.ID,
 		&order.UserID,
 		&order.Number,
@@ -132,13 +245,16 @@ func (r *PostgresOrderRepository) GetByID(id int64) (*model.Order, error) {
 }
 
 // GetByNumber retrieves an order by its number
-func (r *PostgresOrderRepository) GetByNumber(number string) (*model.Order, error) {
+func (r *PostgresOrderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `SELECT id, user_id, number, status, accrual, uploaded_at 
               FROM orders 
               WHERE number = $1`
 
 	order := &model.Order{}
-	err := r.db.QueryRow(query, number).Scan(
+	err := r.db.QueryRowContext(ctx, query, number).Scan(
 		&order.ID,
 		&order.UserID,
 		&order.Number,
@@ -158,13 +274,16 @@ func (r *PostgresOrderRepository) GetByNumber(number string) (*model.Order, erro
 }
 
 // GetByUserID retrieves all orders for a specific user
-func (r *PostgresOrderRepository) GetByUserID(userID int64) ([]*model.Order, error) {
+func (r *PostgresOrderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `SELECT id, user_id, number, status, accrual, uploaded_at 
               FROM orders 
               WHERE user_id = $1
               ORDER BY uploaded_at DESC`
 
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query orders: %w", err)
 	}
@@ -194,44 +313,152 @@ func (r *PostgresOrderRepository) GetByUserID(userID int64) ([]*model.Order, err
 	return orders, nil
 }
 
-// UpdateStatus updates the status of an order
-func (r *PostgresOrderRepository) UpdateStatus(id int64, status model.OrderStatus) error {
-	query := `UPDATE orders SET status = $1 WHERE id = $2`
-
-	result, err := r.db.Exec(query, status, id)
+// ClaimUnprocessed locks orders that still await a final accrual status,
+// oldest first, and pushes their next poll out by the lease, so that the
+// pollers of other instances skip them meanwhile.
+func (r *PostgresOrderRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `WITH due AS (
+                  SELECT id FROM orders
+                  WHERE status IN ($1, $2) AND next_poll_at <= NOW()
+                  ORDER BY uploaded_at, id
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              UPDATE orders o
+              SET next_poll_at = NOW() + make_interval(secs => $4)
+              FROM due
+              WHERE o.id = due.id
+              RETURNING o.id, o.user_id, o.number, o.status, o.accrual, o.uploaded_at`
+
+	rows, err := r.db.QueryContext(ctx, query, model.OrderStatusNew, model.OrderStatusProcessing, limit, lease.Seconds())
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+		return nil, fmt.Errorf("failed to claim unprocessed orders: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	var orders []*model.Order
+	for rows.Next() {
+		order := &model.Order{}
+		err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Number,
+			&order.Status,
+			&order.Accrual,
+			&order.UploadedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
 	}
 
-	if rowsAffected == 0 {
-		return ErrOrderNotFound
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders rows: %w", err)
 	}
 
-	return nil
+	// RETURNING does not preserve the order of the locking subquery
+	sort.Slice(orders, func(i, j int) bool {
+		return uploadedBefore(orders[i], orders[j])
+	})
+
+	return orders, nil
 }
 
-// UpdateAccrual updates the accrual amount for an order
-func (r *PostgresOrderRepository) UpdateAccrual(id int64, accrual float64, status model.OrderStatus) error {
-	query := `UPDATE orders SET accrual = $1, status = $2 WHERE id = $3`
+// CountByStatus returns the number of orders in every status that has any
+func (r *PostgresOrderRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
-	result, err := r.db.Exec(query, accrual, status, id)
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM orders GROUP BY status`)
 	if err != nil {
-		return fmt.Errorf("failed to update order accrual: %w", err)
+		return nil, fmt.Errorf("failed to count orders: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	counts := make(map[model.OrderStatus]int64)
+	for rows.Next() {
+		var status model.OrderStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan order count: %w", err)
+		}
+		counts[status] = count
 	}
 
-	if rowsAffected == 0 {
-		return ErrOrderNotFound
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order counts rows: %w", err)
 	}
 
-	return nil
-}
\ No newline at end of file
+	return counts, nil
+}
+
+// UpdateStatus updates the status of an order and records the change in the outbox
+func (r *PostgresOrderRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInTx(ctx, r.db, func(tx DBTX) error {
+		query := `UPDATE orders SET status = $1 WHERE id = $2 RETURNING user_id, number, accrual`
+
+		payload := model.OrderEventPayload{OrderID: id, Status: status}
+		var userID int64
+		err := tx.QueryRowContext(ctx, query, status, id).Scan(&userID, &payload.Number, &payload.Accrual)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotFound
+			}
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+
+		return appendEvent(ctx, tx, model.EventOrderStatusChanged, userID, payload)
+	})
+}
+
+// UpdateAccrual updates the accrual amount for an order and records the change in the outbox.
+// Processed orders additionally produce an order processed event.
+func (r *PostgresOrderRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInTx(ctx, r.db, func(tx DBTX) error {
+		query := `UPDATE orders SET accrual = $1, status = $2 WHERE id = $3 RETURNING user_id, number`
+
+		payload := model.OrderEventPayload{OrderID: id, Status: status, Accrual: accrual}
+		var userID int64
+		err := tx.QueryRowContext(ctx, query, accrual, status, id).Scan(&userID, &payload.Number)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotFound
+			}
+			return fmt.Errorf("failed to update order accrual: %w", err)
+		}
+
+		if err := appendEvent(ctx, tx, model.EventOrderStatusChanged, userID, payload); err != nil {
+			return err
+		}
+
+		if status == model.OrderStatusProcessed {
+			return appendEvent(ctx, tx, model.EventOrderProcessed, userID, payload)
+		}
+
+		return nil
+	})
+}
+
+// newOrderEventPayload describes an order in the events announcing it
+func newOrderEventPayload(order *model.Order) model.OrderEventPayload {
+	return model.OrderEventPayload{OrderID: order.ID, Number: order.Number, Status: order.Status, Accrual: order.Accrual}
+}
+
+// importedOrderEvents are the events an imported order is announced with:
+// its status and, for processed orders, the accrual it credits
+func importedOrderEvents(order *model.Order) []model.EventType {
+	if order.Status == model.OrderStatusProcessed {
+		return []model.EventType{model.EventOrderStatusChanged, model.EventOrderProcessed}
+	}
+	return []model.EventType{model.EventOrderStatusChanged}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// Outbox event statuses
+const (
+	outboxStatusPending   = "PENDING"
+	outboxStatusProcessed = "PROCESSED"
+	outboxStatusFailed    = "FAILED"
+)
+
+// appendEvent records a domain event in the caller's transaction, so the
+// event exists if and only if the state change it describes commits.
+func appendEvent(ctx context.Context, tx DBTX, eventType model.EventType, userID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `INSERT INTO outbox_events (event_type, user_id, payload, occurred_at)
+              VALUES ($1, $2, $3::jsonb, $4)`
+
+	if _, err := tx.ExecContext(ctx, query, eventType, userID, string(data), time.Now()); err != nil {
+		return fmt.Errorf("failed to append %s event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+type OutboxRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+func NewOutboxRepository(db *sql.DB, queryTimeout time.Duration) *OutboxRepository {
+	return &OutboxRepository{db: db, timeout: queryTimeout}
+}
+
+// ClaimBatch locks due events in occurrence order and pushes their next attempt
+// out by the lease, so concurrent dispatchers skip them while they are handled.
+func (r *OutboxRepository) ClaimBatch(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `WITH due AS (
+                  SELECT id FROM outbox_events
+                  WHERE status = $1 AND next_attempt_at <= NOW()
+                  ORDER BY id
+                  LIMIT $2
+                  FOR UPDATE SKIP LOCKED
+              )
+              UPDATE outbox_events e
+              SET next_attempt_at = NOW() + make_interval(secs => $3)
+              FROM due
+              WHERE e.id = due.id
+              RETURNING e.id, e.event_type, e.user_id, e.payload, e.attempts, e.occurred_at`
+
+	rows, err := r.db.QueryContext(ctx, query, outboxStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.DomainEvent
+	for rows.Next() {
+		event := &model.DomainEvent{}
+		var payload string
+		err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.UserID,
+			&payload,
+			&event.Attempts,
+			&event.OccurredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox events rows: %w", err)
+	}
+
+	// RETURNING does not preserve the order of the locking subquery
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+// MarkProcessed records that every subscriber handled the event
+func (r *OutboxRepository) MarkProcessed(ctx context.Context, id int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE outbox_events SET status = $1, processed_at = NOW(), last_error = NULL WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, outboxStatusProcessed, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event processed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt and either schedules a retry or gives up on the event
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, final bool) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	status := outboxStatusPending
+	if final {
+		status = outboxStatusFailed
+	}
+
+	query := `UPDATE outbox_events
+              SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4
+              WHERE id = $5`
+
+	if _, err := r.db.ExecContext(ctx, query, status, attempts, nextAttemptAt, lastError, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+
+	return nil
+}
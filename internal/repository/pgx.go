@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// PgxDBTX is the subset of *pgxpool.Pool and pgx.Tx the pgx repositories use
+type PgxDBTX interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// PgxTxManager is the Transactor for the pgxpool backend. Like TxManager it
+// runs at serializable isolation and retries aborted transactions.
+type PgxTxManager struct {
+	pool       *pgxpool.Pool
+	timeout    time.Duration
+	maxRetries int
+}
+
+func NewPgxTxManager(pool *pgxpool.Pool, queryTimeout time.Duration) *PgxTxManager {
+	return &PgxTxManager{
+		pool:       pool,
+		timeout:    queryTimeout,
+		maxRetries: 3,
+	}
+}
+
+func (m *PgxTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	return withRetries(ctx, m.maxRetries, func() error {
+		return m.run(ctx, fn)
+	})
+}
+
+func (m *PgxTxManager) run(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	tx, err := m.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repos := &Repositories{
+		Users:       &UserRepository{Impl: &PgxUserRepository{db: tx, timeout: m.timeout}},
+		Orders:      &OrderRepository{Impl: &PgxOrderRepository{db: tx, timeout: m.timeout}},
+		Withdrawals: &WithdrawalRepository{Impl: &PgxWithdrawalRepository{db: tx, timeout: m.timeout}},
+	}
+
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// runInPgxTx is runInTx for the pgx repositories
+func runInPgxTx(ctx context.Context, db PgxDBTX, fn func(tx PgxDBTX) error) error {
+	pool, ok := db.(*pgxpool.Pool)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+const appendPgxEventQuery = `INSERT INTO outbox_events (event_type, user_id, payload, occurred_at)
+              VALUES ($1, $2, $3::jsonb, $4)`
+
+// appendPgxEvent is appendEvent for the pgx repositories
+func appendPgxEvent(ctx context.Context, tx PgxDBTX, eventType model.EventType, userID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	if _, err := tx.Exec(ctx, appendPgxEventQuery, string(eventType), userID, string(data), time.Now()); err != nil {
+		return fmt.Errorf("failed to append %s event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+// queuePgxEvent is appendPgxEvent for events sent with a batch, which must
+// run in the transaction of the state change they describe
+func queuePgxEvent(batch *pgx.Batch, eventType model.EventType, userID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	batch.Queue(appendPgxEventQuery, string(eventType), userID, string(data), time.Now())
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/idempotency"
+)
+
+// PgxIdempotencyRepository is IdempotencyRepository for the pgxpool backend
+type PgxIdempotencyRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxIdempotencyRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *PgxIdempotencyRepository {
+	return &PgxIdempotencyRepository{db: pool, timeout: queryTimeout}
+}
+
+func (r *PgxIdempotencyRepository) Reserve(ctx context.Context, key, token, fingerprint string, ttl, lease time.Duration) (*idempotency.Record, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		var reserved string
+		err := r.db.QueryRow(ctx, reserveKeyQuery, key, fingerprint, ttl.Seconds(), lease.Seconds(), token).Scan(&reserved)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		record := &idempotency.Record{}
+		var response []byte
+		err = r.db.QueryRow(ctx, getKeyQuery, key).Scan(&record.Fingerprint, &response)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		return record, decodeIdempotentResponse(record, response)
+	}
+
+	return nil, errKeyContended
+}
+
+func (r *PgxIdempotencyRepository) Complete(ctx context.Context, key, token string, response *idempotency.Response) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotent response: %w", err)
+	}
+
+	tag, err := r.db.Exec(ctx, completeKeyQuery, key, token, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return idempotency.ErrReservationLost
+	}
+	return nil
+}
+
+func (r *PgxIdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, releaseKeyQuery, key, token); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes expired keys
+func (r *PgxIdempotencyRepository) Prune(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, pruneKeysQuery); err != nil {
+		return fmt.Errorf("failed to prune idempotency keys: %w", err)
+	}
+	return nil
+}
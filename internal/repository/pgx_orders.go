@@ -0,0 +1,404 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// PgxOrderRepository is the pgxpool implementation of OrderRepositoryInterface.
+// Bulk uploads and poller claims are sent as batches and imports use COPY.
+type PgxOrderRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxOrderRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *OrderRepository {
+	return &OrderRepository{Impl: &PgxOrderRepository{db: pool, timeout: queryTimeout}}
+}
+
+const pgxOrderColumns = `id, user_id, number, status, accrual, uploaded_at`
+
+// Create adds a new order to the database. A number that is already taken
+// is reported without failing the statement, so Create is safe to call
+// inside a transaction.
+func (r *PgxOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO orders (user_id, number, status, uploaded_at)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (number) DO NOTHING
+              RETURNING id`
+
+	order.UploadedAt = time.Now()
+
+	err := r.db.QueryRow(
+		ctx,
+		query,
+		order.UserID,
+		order.Number,
+		string(order.Status),
+		order.UploadedAt,
+	).Scan(&order.ID)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Check if the order exists for the same user
+		var ownerID int64
+		err = r.db.QueryRow(ctx, `SELECT user_id FROM orders WHERE number = $1`, order.Number).Scan(&ownerID)
+		if err != nil {
+			return fmt.Errorf("failed to get existing order: %w", err)
+		}
+		if ownerID == order.UserID {
+			return ErrOrderExists
+		}
+		return ErrOrderExistsForUser
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	return nil
+}
+
+// CreateMany uploads orders in one batch. Numbers that are already taken
+// are skipped and keep a zero ID; the number of new orders is returned.
+// Every new order is announced with a status change event.
+func (r *PgxOrderRepository) CreateMany(ctx context.Context, orders []*model.Order) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO orders (user_id, number, status, uploaded_at)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (number) DO NOTHING
+              RETURNING id`
+
+	now := time.Now()
+	created := 0
+	err := runInPgxTx(ctx, r.db, func(tx PgxDBTX) error {
+		batch := &pgx.Batch{}
+		for _, order := range orders {
+			order.UploadedAt = now
+			batch.Queue(query, order.UserID, order.Number, string(order.Status), order.UploadedAt)
+		}
+
+		results := tx.SendBatch(ctx, batch)
+		events := &pgx.Batch{}
+		for _, order := range orders {
+			err := results.QueryRow().Scan(&order.ID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				results.Close()
+				return fmt.Errorf("failed to create order %s: %w", order.Number, err)
+			}
+			created++
+
+			if err := queuePgxEvent(events, model.EventOrderStatusChanged, order.UserID, newOrderEventPayload(order)); err != nil {
+				results.Close()
+				return err
+			}
+		}
+		if err := results.Close(); err != nil {
+			return fmt.Errorf("failed to create orders: %w", err)
+		}
+
+		return sendPgxEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// Import loads orders with COPY, keeping their status, accrual and upload
+// time, and records the events the accrual poller would have. Any
+// conflicting number aborts the whole import.
+func (r *PgxOrderRepository) Import(ctx context.Context, orders []*model.Order) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	rows := make([][]interface{}, 0, len(orders))
+	numbers := make([]string, 0, len(orders))
+	byNumber := make(map[string]*model.Order, len(orders))
+	for _, order := range orders {
+		if order.UploadedAt.IsZero() {
+			order.UploadedAt = now
+		}
+		rows = append(rows, []interface{}{order.UserID, order.Number, string(order.Status), order.Accrual, order.UploadedAt})
+		numbers = append(numbers, order.Number)
+		byNumber[order.Number] = order
+	}
+
+	var count int64
+	err := runInPgxTx(ctx, r.db, func(tx PgxDBTX) error {
+		var err error
+		count, err = tx.CopyFrom(
+			ctx,
+			pgx.Identifier{"orders"},
+			[]string{"user_id", "number", "status", "accrual", "uploaded_at"},
+			pgx.CopyFromRows(rows),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to import orders: %w", err)
+		}
+
+		// COPY returns no IDs, so they are read back for the events
+		idRows, err := tx.Query(ctx, `SELECT id, number FROM orders WHERE number = ANY($1)`, numbers)
+		if err != nil {
+			return fmt.Errorf("failed to query imported orders: %w", err)
+		}
+		defer idRows.Close()
+
+		for idRows.Next() {
+			var id int64
+			var number string
+			if err := idRows.Scan(&id, &number); err != nil {
+				return fmt.Errorf("failed to scan imported order: %w", err)
+			}
+			byNumber[number].ID = id
+		}
+		if err := idRows.Err(); err != nil {
+			return fmt.Errorf("error iterating imported orders rows: %w", err)
+		}
+
+		events := &pgx.Batch{}
+		for _, order := range orders {
+			for _, eventType := range importedOrderEvents(order) {
+				if err := queuePgxEvent(events, eventType, order.UserID, newOrderEventPayload(order)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return sendPgxEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetByID retrieves an order by its ID
+func (r *PgxOrderRepository) GetByID(ctx context.Context, id int64) (*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT ` + pgxOrderColumns + ` FROM orders WHERE id = $1`
+
+	return r.get(ctx, query, id)
+}
+
+// GetByNumber retrieves an order by its number
+func (r *PgxOrderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT ` + pgxOrderColumns + ` FROM orders WHERE number = $1`
+
+	return r.get(ctx, query, number)
+}
+
+// GetByUserID retrieves all orders for a specific user
+func (r *PgxOrderRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT ` + pgxOrderColumns + `
+              FROM orders
+              WHERE user_id = $1
+              ORDER BY uploaded_at DESC`
+
+	return r.list(ctx, query, userID)
+}
+
+// ClaimUnprocessed locks orders that still await a final accrual status,
+// oldest first, and pushes their next poll out by the lease, so that the
+// pollers of other instances skip them meanwhile. The whole batch is
+// claimed in one round trip.
+func (r *PgxOrderRepository) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `WITH due AS (
+                  SELECT id FROM orders
+                  WHERE status IN ($1, $2) AND next_poll_at <= NOW()
+                  ORDER BY uploaded_at, id
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              UPDATE orders o
+              SET next_poll_at = NOW() + make_interval(secs => $4)
+              FROM due
+              WHERE o.id = due.id
+              RETURNING o.id, o.user_id, o.number, o.status, o.accrual, o.uploaded_at`
+
+	orders, err := r.list(ctx, query, string(model.OrderStatusNew), string(model.OrderStatusProcessing), limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the order of the locking subquery
+	sort.Slice(orders, func(i, j int) bool {
+		return uploadedBefore(orders[i], orders[j])
+	})
+
+	return orders, nil
+}
+
+// CountByStatus returns the number of orders in every status that has any
+func (r *PgxOrderRepository) CountByStatus(ctx context.Context) (map[model.OrderStatus]int64, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT status, COUNT(*) FROM orders GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count orders: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[model.OrderStatus]int64)
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan order count: %w", err)
+		}
+		counts[model.OrderStatus(status)] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order counts rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// UpdateStatus updates the status of an order and records the change in the outbox
+func (r *PgxOrderRepository) UpdateStatus(ctx context.Context, id int64, status model.OrderStatus) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, r.db, func(tx PgxDBTX) error {
+		query := `UPDATE orders SET status = $1 WHERE id = $2 RETURNING user_id, number, accrual`
+
+		payload := model.OrderEventPayload{OrderID: id, Status: status}
+		var userID int64
+		err := tx.QueryRow(ctx, query, string(status), id).Scan(&userID, &payload.Number, &payload.Accrual)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrOrderNotFound
+			}
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+
+		return appendPgxEvent(ctx, tx, model.EventOrderStatusChanged, userID, payload)
+	})
+}
+
+// UpdateAccrual updates the accrual amount for an order and records the change in the outbox.
+// Processed orders additionally produce an order processed event.
+func (r *PgxOrderRepository) UpdateAccrual(ctx context.Context, id int64, accrual float64, status model.OrderStatus) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, r.db, func(tx PgxDBTX) error {
+		query := `UPDATE orders SET accrual = $1, status = $2 WHERE id = $3 RETURNING user_id, number`
+
+		payload := model.OrderEventPayload{OrderID: id, Status: status, Accrual: accrual}
+		var userID int64
+		err := tx.QueryRow(ctx, query, accrual, string(status), id).Scan(&userID, &payload.Number)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrOrderNotFound
+			}
+			return fmt.Errorf("failed to update order accrual: %w", err)
+		}
+
+		if err := appendPgxEvent(ctx, tx, model.EventOrderStatusChanged, userID, payload); err != nil {
+			return err
+		}
+
+		if status == model.OrderStatusProcessed {
+			return appendPgxEvent(ctx, tx, model.EventOrderProcessed, userID, payload)
+		}
+
+		return nil
+	})
+}
+
+func (r *PgxOrderRepository) get(ctx context.Context, query string, arg interface{}) (*model.Order, error) {
+	order, err := scanPgxOrder(r.db.QueryRow(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return order, nil
+}
+
+func (r *PgxOrderRepository) list(ctx context.Context, query string, args ...interface{}) ([]*model.Order, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*model.Order
+	for rows.Next() {
+		order, err := scanPgxOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders rows: %w", err)
+	}
+
+	return orders, nil
+}
+
+func scanPgxOrder(row pgx.Row) (*model.Order, error) {
+	order := &model.Order{}
+	var status string
+	err := row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Number,
+		&status,
+		&order.Accrual,
+		&order.UploadedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = model.OrderStatus(status)
+	return order, nil
+}
+
+// sendPgxEvents appends the events queued in batch
+func sendPgxEvents(ctx context.Context, tx PgxDBTX, batch *pgx.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to append order events: %w", err)
+	}
+	return nil
+}
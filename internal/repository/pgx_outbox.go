@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// PgxOutboxRepository is OutboxRepository for the pgxpool backend
+type PgxOutboxRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxOutboxRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *PgxOutboxRepository {
+	return &PgxOutboxRepository{db: pool, timeout: queryTimeout}
+}
+
+// ClaimBatch locks due events in occurrence order and pushes their next attempt
+// out by the lease, so concurrent dispatchers skip them while they are handled.
+func (r *PgxOutboxRepository) ClaimBatch(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `WITH due AS (
+                  SELECT id FROM outbox_events
+                  WHERE status = $1 AND next_attempt_at <= NOW()
+                  ORDER BY id
+                  LIMIT $2
+                  FOR UPDATE SKIP LOCKED
+              )
+              UPDATE outbox_events e
+              SET next_attempt_at = NOW() + make_interval(secs => $3)
+              FROM due
+              WHERE e.id = due.id
+              RETURNING e.id, e.event_type, e.user_id, e.payload, e.attempts, e.occurred_at`
+
+	rows, err := r.db.Query(ctx, query, outboxStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.DomainEvent
+	for rows.Next() {
+		event := &model.DomainEvent{}
+		var eventType string
+		var payload []byte
+		err := rows.Scan(
+			&event.ID,
+			&eventType,
+			&event.UserID,
+			&payload,
+			&event.Attempts,
+			&event.OccurredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Type = model.EventType(eventType)
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox events rows: %w", err)
+	}
+
+	// RETURNING does not preserve the order of the locking subquery
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+// MarkProcessed records that every subscriber handled the event
+func (r *PgxOutboxRepository) MarkProcessed(ctx context.Context, id int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE outbox_events SET status = $1, processed_at = NOW(), last_error = NULL WHERE id = $2`
+
+	if _, err := r.db.Exec(ctx, query, outboxStatusProcessed, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event processed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkProcessedMany records several handled events in one round trip
+func (r *PgxOutboxRepository) MarkProcessedMany(ctx context.Context, ids []int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE outbox_events SET status = $1, processed_at = NOW(), last_error = NULL WHERE id = $2`
+
+	batch := &pgx.Batch{}
+	for _, id := range ids {
+		batch.Queue(query, outboxStatusProcessed, id)
+	}
+
+	if err := r.db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to mark outbox events processed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt and either schedules a retry or gives up on the event
+func (r *PgxOutboxRepository) MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, final bool) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	status := outboxStatusPending
+	if final {
+		status = outboxStatusFailed
+	}
+
+	query := `UPDATE outbox_events
+              SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4
+              WHERE id = $5`
+
+	if _, err := r.db.Exec(ctx, query, status, attempts, nextAttemptAt, lastError, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/ratelimit"
+)
+
+// PgxRateLimitRepository is RateLimitRepository for the pgxpool backend
+type PgxRateLimitRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxRateLimitRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *PgxRateLimitRepository {
+	return &PgxRateLimitRepository{db: pool, timeout: queryTimeout}
+}
+
+func (r *PgxRateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var available float64
+	err := r.db.QueryRow(ctx, takeTokenQuery, key, limit.Burst(), limit.Rate()).Scan(&available)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.db.Exec(ctx, createBucketQuery, key, limit.Burst()); err != nil {
+			return ratelimit.Result{}, fmt.Errorf("failed to create rate limit bucket: %w", err)
+		}
+		err = r.db.QueryRow(ctx, takeTokenQuery, key, limit.Burst(), limit.Rate()).Scan(&available)
+	}
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return ratelimit.NewResult(limit, available), nil
+}
+
+// Prune deletes buckets untouched for longer than idle, which are full again
+func (r *PgxRateLimitRepository) Prune(ctx context.Context, idle time.Duration) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.Exec(ctx, pruneBucketsQuery, idle.Seconds()); err != nil {
+		return fmt.Errorf("failed to prune rate limit buckets: %w", err)
+	}
+	return nil
+}
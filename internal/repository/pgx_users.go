@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// PgxUserRepository is the pgxpool implementation of UserRepositoryInterface
+type PgxUserRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxUserRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *UserRepository {
+	return &UserRepository{Impl: &PgxUserRepository{db: pool, timeout: queryTimeout}}
+}
+
+func (r *PgxUserRepository) Create(ctx context.Context, user *model.User) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO users (login, password, created_at, updated_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id`
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	err := r.db.QueryRow(ctx, query, user.Login, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrUserExists
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PgxUserRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT id, login, password, created_at, updated_at, deleted_at
+              FROM users
+              WHERE LOWER(login) = LOWER($1) AND deleted_at IS NULL`
+
+	return r.get(ctx, query, login)
+}
+
+func (r *PgxUserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT id, login, password, created_at, updated_at, deleted_at
+              FROM users
+              WHERE id = $1 AND deleted_at IS NULL`
+
+	return r.get(ctx, query, id)
+}
+
+func (r *PgxUserRepository) get(ctx context.Context, query string, arg interface{}) (*model.User, error) {
+	user := &model.User{}
+	err := r.db.QueryRow(ctx, query, arg).Scan(
+		&user.ID,
+		&user.Login,
+		&user.Password,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.DeletedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
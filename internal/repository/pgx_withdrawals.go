@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// PgxWithdrawalRepository is the pgxpool implementation of WithdrawalRepositoryInterface
+type PgxWithdrawalRepository struct {
+	db      PgxDBTX
+	timeout time.Duration
+}
+
+func NewPgxWithdrawalRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *WithdrawalRepository {
+	return &WithdrawalRepository{Impl: &PgxWithdrawalRepository{db: pool, timeout: queryTimeout}}
+}
+
+// Create records a withdrawal together with its outbox event. It fails with
+// ErrInsufficientFunds when the balance does not cover the sum and with
+// ErrUserNotFound when the user does not exist.
+func (r *PgxWithdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, r.db, func(tx PgxDBTX) error {
+		var userID int64
+		if err := tx.QueryRow(ctx, lockUserQuery, withdrawal.UserID).Scan(&userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+
+		var accrued, withdrawn float64
+		if err := tx.QueryRow(ctx, balanceQuery, withdrawal.UserID).Scan(&accrued, &withdrawn); err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+		if accrued-withdrawn < withdrawal.Sum {
+			return ErrInsufficientFunds
+		}
+
+		query := `INSERT INTO withdrawals (user_id, order_number, sum, processed_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id`
+
+		withdrawal.ProcessedAt = time.Now()
+
+		err := tx.QueryRow(
+			ctx,
+			query,
+			withdrawal.UserID,
+			withdrawal.OrderNumber,
+			withdrawal.Sum,
+			withdrawal.ProcessedAt,
+		).Scan(&withdrawal.ID)
+
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return ErrWithdrawalExists
+			}
+			return fmt.Errorf("failed to create withdrawal: %w", err)
+		}
+
+		payload := model.WithdrawalEventPayload{
+			WithdrawalID: withdrawal.ID,
+			Order:        withdrawal.OrderNumber,
+			Sum:          withdrawal.Sum,
+			ProcessedAt:  withdrawal.ProcessedAt,
+		}
+		return appendPgxEvent(ctx, tx, model.EventWithdrawalMade, withdrawal.UserID, payload)
+	})
+}
+
+// GetByUserID retrieves all withdrawals for a specific user
+func (r *PgxWithdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, order_number, sum, processed_at
+              FROM withdrawals
+              WHERE user_id = $1
+              ORDER BY processed_at DESC`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var withdrawals []*model.Withdrawal
+	for rows.Next() {
+		withdrawal := &model.Withdrawal{}
+		err := rows.Scan(
+			&withdrawal.ID,
+			&withdrawal.UserID,
+			&withdrawal.OrderNumber,
+			&withdrawal.Sum,
+			&withdrawal.ProcessedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating withdrawals rows: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+// GetBalance calculates the current and withdrawn points of a user
+func (r *PgxWithdrawalRepository) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var accrued, withdrawn float64
+	if err := r.db.QueryRow(ctx, balanceQuery, userID).Scan(&accrued, &withdrawn); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	return &model.Balance{
+		Current:   accrued - withdrawn,
+		Withdrawn: withdrawn,
+	}, nil
+}
@@ -0,0 +1,353 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/events"
+	"github.com/riouske/gophermart/internal/idempotency"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/outbox"
+	"github.com/riouske/gophermart/internal/ratelimit"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/repository/repotest"
+	"github.com/riouske/gophermart/internal/tests"
+)
+
+func newPostgresRepositories(t *testing.T) *repository.Repositories {
+	repos, _ := newPostgresRepositoriesWithOutbox(t)
+	return repos
+}
+
+func newPostgresRepositoriesWithOutbox(t *testing.T) (*repository.Repositories, outbox.Store) {
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	t.Cleanup(func() { db.Close() })
+
+	timeout := tests.TestConfig().QueryTimeout
+	return &repository.Repositories{
+		Users:       repository.NewUserRepository(db, timeout),
+		Orders:      repository.NewOrderRepository(db, timeout),
+		Withdrawals: repository.NewWithdrawalRepository(db, timeout),
+	}, repository.NewOutboxRepository(db, timeout)
+}
+
+func TestPostgresOrderRepository(t *testing.T) {
+	repotest.RunOrderRepositoryTests(t, newPostgresRepositories)
+}
+
+func TestPostgresOrderRepository_Events(t *testing.T) {
+	repotest.RunOrderEventTests(t, newPostgresRepositoriesWithOutbox)
+}
+
+func TestPostgresUserRepository(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, newPostgresRepositories)
+}
+
+func TestPostgresWithdrawalRepository(t *testing.T) {
+	repotest.RunWithdrawalRepositoryTests(t, newPostgresRepositories)
+}
+
+func newPgxRepositories(t *testing.T) *repository.Repositories {
+	repos, _ := newPgxRepositoriesWithOutbox(t)
+	return repos
+}
+
+func newPgxRepositoriesWithOutbox(t *testing.T) (*repository.Repositories, outbox.Store) {
+	// Reuse the database/sql connection only to reset the schema
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	db.Close()
+
+	pool := tests.TestPool(t)
+	t.Cleanup(pool.Close)
+
+	timeout := tests.TestConfig().QueryTimeout
+	return &repository.Repositories{
+		Users:       repository.NewPgxUserRepository(pool, timeout),
+		Orders:      repository.NewPgxOrderRepository(pool, timeout),
+		Withdrawals: repository.NewPgxWithdrawalRepository(pool, timeout),
+	}, repository.NewPgxOutboxRepository(pool, timeout)
+}
+
+func TestPgxOrderRepository(t *testing.T) {
+	repotest.RunOrderRepositoryTests(t, newPgxRepositories)
+}
+
+func TestPgxOrderRepository_Events(t *testing.T) {
+	repotest.RunOrderEventTests(t, newPgxRepositoriesWithOutbox)
+}
+
+func TestPgxUserRepository(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, newPgxRepositories)
+}
+
+func TestPgxWithdrawalRepository(t *testing.T) {
+	repotest.RunWithdrawalRepositoryTests(t, newPgxRepositories)
+}
+
+// testOrderDuplicateInTx checks that a taken number is reported inside a
+// transaction, where a failed statement would abort everything after it
+func testOrderDuplicateInTx(t *testing.T, repos *repository.Repositories, tx repository.Transactor) {
+	ctx := context.Background()
+	owner := &model.User{Login: "tx-owner", Password: "hash"}
+	other := &model.User{Login: "tx-other", Password: "hash"}
+	for _, user := range []*model.User{owner, other} {
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	if err := repos.Orders.Create(ctx, &model.Order{UserID: owner.ID, Number: "79927398713", Status: model.OrderStatusNew}); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	err := tx.WithinTx(ctx, func(ctx context.Context, repos *repository.Repositories) error {
+		err := repos.Orders.Create(ctx, &model.Order{UserID: other.ID, Number: "79927398713", Status: model.OrderStatusNew})
+		if !errors.Is(err, repository.ErrOrderExistsForUser) {
+			t.Errorf("other user upload: got %v, want %v", err, repository.ErrOrderExistsForUser)
+		}
+		err = repos.Orders.Create(ctx, &model.Order{UserID: owner.ID, Number: "79927398713", Status: model.OrderStatusNew})
+		if !errors.Is(err, repository.ErrOrderExists) {
+			t.Errorf("same user upload: got %v, want %v", err, repository.ErrOrderExists)
+		}
+		// The transaction is still usable after the conflicts
+		return repos.Orders.Create(ctx, &model.Order{UserID: other.ID, Number: "12345678903", Status: model.OrderStatusNew})
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if _, err := repos.Orders.GetByNumber(ctx, "12345678903"); err != nil {
+		t.Errorf("Expected the order created after the conflicts, got %v", err)
+	}
+}
+
+func TestPostgresOrderRepository_DuplicateInTx(t *testing.T) {
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	t.Cleanup(func() { db.Close() })
+
+	timeout := tests.TestConfig().QueryTimeout
+	repos := &repository.Repositories{
+		Users:  repository.NewUserRepository(db, timeout),
+		Orders: repository.NewOrderRepository(db, timeout),
+	}
+	testOrderDuplicateInTx(t, repos, repository.NewTxManager(db, timeout))
+}
+
+func TestPgxOrderRepository_DuplicateInTx(t *testing.T) {
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	db.Close()
+
+	pool := tests.TestPool(t)
+	t.Cleanup(pool.Close)
+
+	timeout := tests.TestConfig().QueryTimeout
+	repos := &repository.Repositories{
+		Users:  repository.NewPgxUserRepository(pool, timeout),
+		Orders: repository.NewPgxOrderRepository(pool, timeout),
+	}
+	testOrderDuplicateInTx(t, repos, repository.NewPgxTxManager(pool, timeout))
+}
+
+func testRateLimitStore(t *testing.T, store ratelimit.Store) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s|%d", t.Name(), time.Now().UnixNano())
+	limit := ratelimit.Limit{Requests: 2, Per: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("Failed to take token: %v", err)
+		}
+		if !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("Expected request %d allowed with %d left, got %+v", i+1, 1-i, result)
+		}
+	}
+
+	result, err := store.Take(ctx, key, limit)
+	if err != nil {
+		t.Fatalf("Failed to take token: %v", err)
+	}
+	if result.Allowed || result.RetryAfter <= 0 {
+		t.Errorf("Expected the third request to be rejected, got %+v", result)
+	}
+}
+
+func TestPostgresRateLimitRepository(t *testing.T) {
+	db := tests.TestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	testRateLimitStore(t, repository.NewRateLimitRepository(db, tests.TestConfig().QueryTimeout))
+}
+
+func TestPgxRateLimitRepository(t *testing.T) {
+	pool := tests.TestPool(t)
+	t.Cleanup(pool.Close)
+
+	testRateLimitStore(t, repository.NewPgxRateLimitRepository(pool, tests.TestConfig().QueryTimeout))
+}
+
+func testIdempotencyStore(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s|%d", t.Name(), time.Now().UnixNano())
+
+	record, err := store.Reserve(ctx, key, "token-a", "a", time.Hour, time.Minute)
+	if err != nil || record != nil {
+		t.Fatalf("Expected a free key, got %+v, %v", record, err)
+	}
+
+	record, err = store.Reserve(ctx, key, "token-b", "a", time.Hour, time.Minute)
+	if err != nil || record == nil || record.Response != nil {
+		t.Fatalf("Expected an in-progress record, got %+v, %v", record, err)
+	}
+
+	response := &idempotency.Response{Status: 202, Header: map[string][]string{"Content-Type": {"application/json"}}, Body: []byte(`{}`)}
+	if err := store.Complete(ctx, key, "token-a", response); err != nil {
+		t.Fatalf("Failed to complete key: %v", err)
+	}
+	record, err = store.Reserve(ctx, key, "token-c", "b", time.Hour, time.Minute)
+	if err != nil || record == nil || record.Fingerprint != "a" || !reflect.DeepEqual(record.Response, response) {
+		t.Fatalf("Expected the stored response, got %+v, %v", record, err)
+	}
+
+	if err := store.Release(ctx, key, "token-a"); err != nil {
+		t.Fatalf("Failed to release key: %v", err)
+	}
+	if record, err := store.Reserve(ctx, key, "token-d", "c", time.Hour, time.Minute); err != nil || record != nil {
+		t.Fatalf("Expected the released key to be free, got %+v, %v", record, err)
+	}
+
+	// A request that never completes loses the key once its lease is over
+	abandoned := key + "|abandoned"
+	if record, err := store.Reserve(ctx, abandoned, "token-a", "a", time.Hour, 10*time.Millisecond); err != nil || record != nil {
+		t.Fatalf("Expected a free key, got %+v, %v", record, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if record, err := store.Reserve(ctx, abandoned, "token-b", "b", time.Hour, time.Minute); err != nil || record != nil {
+		t.Fatalf("Expected the abandoned key to be taken over, got %+v, %v", record, err)
+	}
+
+	// The request that lost the key can neither complete nor release it
+	if err := store.Complete(ctx, abandoned, "token-a", response); !errors.Is(err, idempotency.ErrReservationLost) {
+		t.Fatalf("Complete after a takeover: got %v, want %v", err, idempotency.ErrReservationLost)
+	}
+	if err := store.Release(ctx, abandoned, "token-a"); err != nil {
+		t.Fatalf("Failed to release key: %v", err)
+	}
+	record, err = store.Reserve(ctx, abandoned, "token-c", "c", time.Hour, time.Minute)
+	if err != nil || record == nil || record.Fingerprint != "b" || record.Response != nil {
+		t.Fatalf("Expected the key held by the retry, got %+v, %v", record, err)
+	}
+}
+
+func TestPostgresIdempotencyRepository(t *testing.T) {
+	db := tests.TestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	testIdempotencyStore(t, repository.NewIdempotencyRepository(db, tests.TestConfig().QueryTimeout))
+}
+
+func TestPgxIdempotencyRepository(t *testing.T) {
+	pool := tests.TestPool(t)
+	t.Cleanup(pool.Close)
+
+	testIdempotencyStore(t, repository.NewPgxIdempotencyRepository(pool, tests.TestConfig().QueryTimeout))
+}
+
+func TestPostgresWebhookRepository_Replay(t *testing.T) {
+	ctx := context.Background()
+	db := tests.TestDB(t)
+	tests.CleanupDB(t, db)
+	t.Cleanup(func() { db.Close() })
+
+	timeout := tests.TestConfig().QueryTimeout
+	user := &model.User{Login: "replay", Password: "hash"}
+	if err := repository.NewUserRepository(db, timeout).Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	webhooks := repository.NewWebhookRepository(db, timeout)
+	webhook := &model.Webhook{UserID: user.ID, URL: "https://example.com/hook", Secret: "secret", Events: []model.WebhookEvent{model.WebhookEventOrderProcessed}}
+	if err := webhooks.Create(ctx, webhook); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if err := webhooks.EnqueueForEvent(ctx, 1, user.ID, model.WebhookEventOrderProcessed, map[string]string{}); err != nil {
+		t.Fatalf("Failed to enqueue delivery: %v", err)
+	}
+
+	deliveries, err := webhooks.ClaimDue(ctx, 10, time.Minute)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected one claimed delivery, got %d, %v", len(deliveries), err)
+	}
+	id := deliveries[0].ID
+
+	// Claimed deliveries are in flight and must not be claimed again
+	if err := webhooks.Replay(ctx, user.ID, id); !errors.Is(err, repository.ErrDeliveryInFlight) {
+		t.Fatalf("Replay of a delivery in flight: got %v, want %v", err, repository.ErrDeliveryInFlight)
+	}
+	if claimed, err := webhooks.ClaimDue(ctx, 10, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("Expected nothing to claim, got %d, %v", len(claimed), err)
+	}
+
+	if err := webhooks.MarkDelivered(ctx, id, 1); err != nil {
+		t.Fatalf("Failed to mark delivered: %v", err)
+	}
+	if err := webhooks.Replay(ctx, user.ID, id); err != nil {
+		t.Fatalf("Replay of a delivered delivery failed: %v", err)
+	}
+	if claimed, err := webhooks.ClaimDue(ctx, 10, time.Minute); err != nil || len(claimed) != 1 {
+		t.Fatalf("Expected the replayed delivery to be claimed, got %d, %v", len(claimed), err)
+	}
+
+	if err := webhooks.Replay(ctx, user.ID+1, id); !errors.Is(err, repository.ErrDeliveryNotFound) {
+		t.Errorf("Replay for another user: got %v, want %v", err, repository.ErrDeliveryNotFound)
+	}
+}
+
+func TestLiveEventRepository(t *testing.T) {
+	db := tests.TestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// Two instances share the database, each with its own hub
+	cfg := tests.TestConfig()
+	sender := repository.NewLiveEventRepository(db, cfg.DatabaseURI, cfg.QueryTimeout)
+	receiver := repository.NewLiveEventRepository(db, cfg.DatabaseURI, cfg.QueryTimeout)
+	hub := events.NewHub(8)
+	go receiver.Listen(ctx, hub)
+
+	sub := hub.Subscribe(7)
+	defer sub.Close()
+
+	// The listener connects in the background, so broadcast until it hears
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := sender.Broadcast(ctx, events.Event{Type: events.TypeBalanceChanged, UserID: 7, Data: map[string]float64{"current": 42}}); err != nil {
+			t.Fatalf("Failed to broadcast: %v", err)
+		}
+
+		select {
+		case event := <-sub.C:
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Type != events.TypeBalanceChanged || string(data) != `{"current":42}` {
+				t.Errorf("Unexpected event %s %s", event.Type, data)
+			}
+			return
+		case <-ticker.C:
+		case <-deadline:
+			t.Fatal("Expected the broadcast to reach the other instance's hub")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/riouske/gophermart/internal/ratelimit"
+)
+
+// takeTokenQuery refills the bucket for the time elapsed since it was last
+// used and takes a token when one is available. The locking subquery exposes
+// the tokens available before the take, which decide the outcome.
+const takeTokenQuery = `UPDATE rate_limit_buckets b
+              SET tokens = CASE WHEN old.available >= 1 THEN old.available - 1 ELSE old.available END,
+                  updated_at = NOW()
+              FROM (
+                  SELECT key, LEAST($2::float8,
+                      tokens + GREATEST(EXTRACT(EPOCH FROM NOW() - updated_at)::float8, 0) * $3::float8) AS available
+                  FROM rate_limit_buckets
+                  WHERE key = $1
+                  FOR UPDATE
+              ) old
+              WHERE b.key = old.key
+              RETURNING old.available`
+
+// createBucketQuery adds a full bucket, unless a concurrent request did
+const createBucketQuery = `INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+              VALUES ($1, $2, NOW())
+              ON CONFLICT (key) DO NOTHING`
+
+const pruneBucketsQuery = `DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - make_interval(secs => $1)`
+
+// RateLimitRepository is the ratelimit.Store shared by every instance of
+// the service through PostgreSQL
+type RateLimitRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+func NewRateLimitRepository(db *sql.DB, queryTimeout time.Duration) *RateLimitRepository {
+	return &RateLimitRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var available float64
+	err := r.db.QueryRowContext(ctx, takeTokenQuery, key, limit.Burst(), limit.Rate()).Scan(&available)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.db.ExecContext(ctx, createBucketQuery, key, limit.Burst()); err != nil {
+			return ratelimit.Result{}, fmt.Errorf("failed to create rate limit bucket: %w", err)
+		}
+		err = r.db.QueryRowContext(ctx, takeTokenQuery, key, limit.Burst(), limit.Rate()).Scan(&available)
+	}
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return ratelimit.NewResult(limit, available), nil
+}
+
+// Prune deletes buckets untouched for longer than idle, which are full again
+func (r *RateLimitRepository) Prune(ctx context.Context, idle time.Duration) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, pruneBucketsQuery, idle.Seconds()); err != nil {
+		return fmt.Errorf("failed to prune rate limit buckets: %w", err)
+	}
+	return nil
+}
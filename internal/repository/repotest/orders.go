@@ -0,0 +1,584 @@
+// Package repotest holds the contract every repository backend must satisfy.
+// Backends run it from their own tests with a factory for empty repositories.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/outbox"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+// Factory returns repositories over a fresh, empty store
+type Factory func(t *testing.T) *repository.Repositories
+
+// RunOrderRepositoryTests checks that the backend's orders behave like the reference implementation
+func RunOrderRepositoryTests(t *testing.T, newRepos Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		testOrderCreateAndGet(t, newRepos(t))
+	})
+	t.Run("DuplicateNumber", func(t *testing.T) {
+		testOrderDuplicateNumber(t, newRepos(t))
+	})
+	t.Run("GetByUserIDNewestFirst", func(t *testing.T) {
+		testOrderGetByUserID(t, newRepos(t))
+	})
+	t.Run("CreateMany", func(t *testing.T) {
+		testOrderCreateMany(t, newRepos(t))
+	})
+	t.Run("Import", func(t *testing.T) {
+		testOrderImport(t, newRepos(t))
+	})
+	t.Run("ClaimUnprocessed", func(t *testing.T) {
+		testOrderClaimUnprocessed(t, newRepos(t))
+	})
+	t.Run("CountByStatus", func(t *testing.T) {
+		testOrderCountByStatus(t, newRepos(t))
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		testOrderNotFound(t, newRepos(t))
+	})
+	t.Run("UpdateStatusAndAccrual", func(t *testing.T) {
+		testOrderUpdate(t, newRepos(t))
+	})
+	t.Run("ConcurrentInserts", func(t *testing.T) {
+		testOrderConcurrentInserts(t, newRepos(t))
+	})
+	t.Run("ConcurrentUpdates", func(t *testing.T) {
+		testOrderConcurrentUpdates(t, newRepos(t))
+	})
+}
+
+// OutboxFactory returns repositories over a fresh, empty store together
+// with the outbox their events are recorded in
+type OutboxFactory func(t *testing.T) (*repository.Repositories, outbox.Store)
+
+// RunOrderEventTests checks that the backend's bulk order paths record the
+// same events as the reference implementation
+func RunOrderEventTests(t *testing.T, newRepos OutboxFactory) {
+	t.Run("CreateMany", func(t *testing.T) {
+		repos, store := newRepos(t)
+		testOrderCreateManyEvents(t, repos, store)
+	})
+	t.Run("Import", func(t *testing.T) {
+		repos, store := newRepos(t)
+		testOrderImportEvents(t, repos, store)
+	})
+}
+
+func testOrderCreateAndGet(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-create")
+
+	order := createOrder(t, repos, userID, "12345678903")
+	if order.ID == 0 {
+		t.Fatal("expected order ID to be assigned")
+	}
+	if order.UploadedAt.IsZero() {
+		t.Fatal("expected uploaded_at to be set")
+	}
+
+	byID, err := repos.Orders.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if byID.Number != order.Number || byID.UserID != userID || byID.Status != model.OrderStatusNew {
+		t.Errorf("GetByID returned %+v, want number %s for user %d in status NEW", byID, order.Number, userID)
+	}
+
+	byNumber, err := repos.Orders.GetByNumber(ctx, order.Number)
+	if err != nil {
+		t.Fatalf("GetByNumber failed: %v", err)
+	}
+	if byNumber.ID != order.ID {
+		t.Errorf("GetByNumber returned order %d, want %d", byNumber.ID, order.ID)
+	}
+}
+
+func testOrderDuplicateNumber(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	owner := createUser(t, repos, "orders-owner")
+	other := createUser(t, repos, "orders-other")
+
+	createOrder(t, repos, owner, "79927398713")
+
+	err := repos.Orders.Create(ctx, &model.Order{UserID: owner, Number: "79927398713", Status: model.OrderStatusNew})
+	if !errors.Is(err, repository.ErrOrderExists) {
+		t.Errorf("same user upload: got %v, want %v", err, repository.ErrOrderExists)
+	}
+
+	err = repos.Orders.Create(ctx, &model.Order{UserID: other, Number: "79927398713", Status: model.OrderStatusNew})
+	if !errors.Is(err, repository.ErrOrderExistsForUser) {
+		t.Errorf("other user upload: got %v, want %v", err, repository.ErrOrderExistsForUser)
+	}
+
+	orders, err := repos.Orders.GetByUserID(ctx, other)
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("rejected upload must not be stored, got %d orders", len(orders))
+	}
+}
+
+func testOrderGetByUserID(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-list")
+	otherID := createUser(t, repos, "orders-list-other")
+
+	numbers := []string{"4561261212345467", "49927398716", "1234567812345670"}
+	for _, number := range numbers {
+		createOrder(t, repos, userID, number)
+		// Keep upload times apart so the ordering is unambiguous
+		time.Sleep(5 * time.Millisecond)
+	}
+	createOrder(t, repos, otherID, "378282246310005")
+
+	orders, err := repos.Orders.GetByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if len(orders) != len(numbers) {
+		t.Fatalf("got %d orders, want %d", len(orders), len(numbers))
+	}
+	for i, order := range orders {
+		want := numbers[len(numbers)-1-i]
+		if order.Number != want {
+			t.Errorf("orders[%d] = %s, want %s", i, order.Number, want)
+		}
+	}
+
+	orders, err = repos.Orders.GetByUserID(ctx, createUser(t, repos, "orders-list-empty"))
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("got %d orders for a user without uploads, want 0", len(orders))
+	}
+}
+
+func testOrderCreateMany(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	owner := createUser(t, repos, "orders-bulk")
+	other := createUser(t, repos, "orders-bulk-other")
+
+	createOrder(t, repos, owner, "79927398713")
+	createOrder(t, repos, other, "4111111111111111")
+
+	orders := []*model.Order{
+		{UserID: owner, Number: "79927398713", Status: model.OrderStatusNew},
+		{UserID: owner, Number: "12345678903", Status: model.OrderStatusNew},
+		{UserID: owner, Number: "4111111111111111", Status: model.OrderStatusNew},
+		{UserID: owner, Number: "12345678903", Status: model.OrderStatusNew},
+		{UserID: owner, Number: "49927398716", Status: model.OrderStatusNew},
+	}
+	created, err := repos.Orders.CreateMany(ctx, orders)
+	if err != nil {
+		t.Fatalf("CreateMany failed: %v", err)
+	}
+	if created != 2 {
+		t.Errorf("CreateMany created %d orders, want 2", created)
+	}
+	for i, order := range orders {
+		isNew := i == 1 || i == 4
+		if (order.ID != 0) != isNew {
+			t.Errorf("orders[%d] %s has ID %d, want an ID only for new numbers", i, order.Number, order.ID)
+		}
+		if order.UploadedAt.IsZero() {
+			t.Errorf("orders[%d] %s has no upload time", i, order.Number)
+		}
+	}
+
+	got, err := repos.Orders.GetByUserID(ctx, owner)
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("got %d orders for the uploader, want 3", len(got))
+	}
+	byNumber, err := repos.Orders.GetByNumber(ctx, "4111111111111111")
+	if err != nil {
+		t.Fatalf("GetByNumber failed: %v", err)
+	}
+	if byNumber.UserID != other {
+		t.Errorf("order of another user moved to user %d", byNumber.UserID)
+	}
+}
+
+func testOrderImport(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-import")
+	uploadedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	orders := []*model.Order{
+		{UserID: userID, Number: "79927398713", Status: model.OrderStatusProcessed, Accrual: 500, UploadedAt: uploadedAt},
+		{UserID: userID, Number: "12345678903", Status: model.OrderStatusNew},
+	}
+	count, err := repos.Orders.Import(ctx, orders)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Import loaded %d orders, want 2", count)
+	}
+
+	got, err := repos.Orders.GetByNumber(ctx, "79927398713")
+	if err != nil {
+		t.Fatalf("GetByNumber failed: %v", err)
+	}
+	if got.Status != model.OrderStatusProcessed || got.Accrual != 500 || !got.UploadedAt.Equal(uploadedAt) {
+		t.Errorf("imported order is %s with %v uploaded at %v, want %s with 500 uploaded at %v",
+			got.Status, got.Accrual, got.UploadedAt, model.OrderStatusProcessed, uploadedAt)
+	}
+	balance, err := repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Current != 500 {
+		t.Errorf("balance = %v, want the 500 imported", balance.Current)
+	}
+
+	// A taken number aborts the whole import
+	_, err = repos.Orders.Import(ctx, []*model.Order{
+		{UserID: userID, Number: "49927398716", Status: model.OrderStatusNew},
+		{UserID: userID, Number: "12345678903", Status: model.OrderStatusNew},
+	})
+	if err == nil {
+		t.Fatal("Import of a taken number succeeded")
+	}
+	if _, err := repos.Orders.GetByNumber(ctx, "49927398716"); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("order of a failed import: got %v, want %v", err, repository.ErrOrderNotFound)
+	}
+}
+
+func testOrderClaimUnprocessed(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-unprocessed")
+
+	first := createOrder(t, repos, userID, "4111111111111111")
+	time.Sleep(5 * time.Millisecond)
+	processing := createOrder(t, repos, userID, "5555555555554444")
+	time.Sleep(5 * time.Millisecond)
+	invalid := createOrder(t, repos, userID, "4012888888881881")
+	time.Sleep(5 * time.Millisecond)
+	processed := createOrder(t, repos, userID, "6011111111111117")
+
+	if err := repos.Orders.UpdateStatus(ctx, processing.ID, model.OrderStatusProcessing); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	if err := repos.Orders.UpdateStatus(ctx, invalid.ID, model.OrderStatusInvalid); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	if err := repos.Orders.UpdateAccrual(ctx, processed.ID, 10, model.OrderStatusProcessed); err != nil {
+		t.Fatalf("UpdateAccrual failed: %v", err)
+	}
+
+	orders, err := repos.Orders.ClaimUnprocessed(ctx, 1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("ClaimUnprocessed failed: %v", err)
+	}
+	if len(orders) != 1 || orders[0].ID != first.ID {
+		t.Fatalf("ClaimUnprocessed with limit 1 returned %v, want [%d]", orderIDs(orders), first.ID)
+	}
+
+	// The claim lapses with its lease
+	time.Sleep(50 * time.Millisecond)
+	orders, err = repos.Orders.ClaimUnprocessed(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimUnprocessed failed: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != first.ID || orders[1].ID != processing.ID {
+		t.Fatalf("ClaimUnprocessed returned %v, want orders %d and %d oldest first", orderIDs(orders), first.ID, processing.ID)
+	}
+
+	orders, err = repos.Orders.ClaimUnprocessed(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimUnprocessed failed: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("ClaimUnprocessed returned the claimed orders %v again", orderIDs(orders))
+	}
+}
+
+func testOrderCountByStatus(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+
+	counts, err := repos.Orders.CountByStatus(ctx)
+	if err != nil {
+		t.Fatalf("CountByStatus failed: %v", err)
+	}
+	if len(counts) != 0 {
+		t.Fatalf("CountByStatus on an empty store returned %v", counts)
+	}
+
+	userID := createUser(t, repos, "orders-count")
+	createOrder(t, repos, userID, "4111111111111111")
+	createOrder(t, repos, userID, "5555555555554444")
+	invalid := createOrder(t, repos, userID, "4012888888881881")
+	if err := repos.Orders.UpdateStatus(ctx, invalid.ID, model.OrderStatusInvalid); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+
+	counts, err = repos.Orders.CountByStatus(ctx)
+	if err != nil {
+		t.Fatalf("CountByStatus failed: %v", err)
+	}
+	want := map[model.OrderStatus]int64{model.OrderStatusNew: 2, model.OrderStatusInvalid: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("CountByStatus returned %v, want %v", counts, want)
+	}
+}
+
+func testOrderNotFound(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+
+	if _, err := repos.Orders.GetByID(ctx, 999999); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetByID: got %v, want %v", err, repository.ErrOrderNotFound)
+	}
+	if _, err := repos.Orders.GetByNumber(ctx, "0000000000"); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetByNumber: got %v, want %v", err, repository.ErrOrderNotFound)
+	}
+	if err := repos.Orders.UpdateStatus(ctx, 999999, model.OrderStatusProcessing); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("UpdateStatus: got %v, want %v", err, repository.ErrOrderNotFound)
+	}
+	if err := repos.Orders.UpdateAccrual(ctx, 999999, 1, model.OrderStatusProcessed); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("UpdateAccrual: got %v, want %v", err, repository.ErrOrderNotFound)
+	}
+}
+
+func testOrderUpdate(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-update")
+	order := createOrder(t, repos, userID, "30569309025904")
+
+	if err := repos.Orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessing); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	got, err := repos.Orders.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Status != model.OrderStatusProcessing {
+		t.Errorf("status = %s, want %s", got.Status, model.OrderStatusProcessing)
+	}
+
+	if err := repos.Orders.UpdateAccrual(ctx, order.ID, 729.98, model.OrderStatusProcessed); err != nil {
+		t.Fatalf("UpdateAccrual failed: %v", err)
+	}
+	got, err = repos.Orders.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Status != model.OrderStatusProcessed || got.Accrual != 729.98 {
+		t.Errorf("got status %s with accrual %v, want %s with 729.98", got.Status, got.Accrual, model.OrderStatusProcessed)
+	}
+}
+
+func testOrderConcurrentInserts(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	const workers = 10
+
+	userIDs := make([]int64, workers)
+	for i := range userIDs {
+		userIDs[i] = createUser(t, repos, fmt.Sprintf("orders-concurrent-%d", i))
+	}
+
+	// Every user races for the same number: exactly one upload may win
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repos.Orders.Create(ctx, &model.Order{UserID: userIDs[i], Number: "5105105105105100", Status: model.OrderStatusNew})
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, repository.ErrOrderExistsForUser):
+			t.Errorf("worker %d: got %v, want nil or %v", i, err, repository.ErrOrderExistsForUser)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d concurrent uploads of one number succeeded, want 1", created)
+	}
+
+	// Distinct numbers must all be stored
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repos.Orders.Create(ctx, &model.Order{UserID: userIDs[0], Number: fmt.Sprintf("9000%06d", i), Status: model.OrderStatusNew})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("worker %d: unexpected error %v", i, err)
+		}
+	}
+
+	orders, err := repos.Orders.GetByUserID(ctx, userIDs[0])
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	ids := make(map[int64]bool)
+	for _, order := range orders {
+		ids[order.ID] = true
+	}
+	if len(ids) < workers {
+		t.Errorf("got %d distinct orders, want at least %d", len(ids), workers)
+	}
+}
+
+func testOrderConcurrentUpdates(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	const workers = 10
+	userID := createUser(t, repos, "orders-concurrent-updates")
+
+	orders := make([]*model.Order, workers)
+	for i := range orders {
+		orders[i] = createOrder(t, repos, userID, fmt.Sprintf("8000%06d", i))
+	}
+
+	var wg sync.WaitGroup
+	for i, order := range orders {
+		wg.Add(1)
+		go func(i int, id int64) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = repos.Orders.UpdateAccrual(ctx, id, float64(i), model.OrderStatusProcessed)
+			} else {
+				err = repos.Orders.UpdateStatus(ctx, id, model.OrderStatusInvalid)
+			}
+			if err != nil {
+				t.Errorf("update of order %d failed: %v", id, err)
+			}
+		}(i, order.ID)
+	}
+	wg.Wait()
+
+	for i, order := range orders {
+		got, err := repos.Orders.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID failed: %v", err)
+		}
+		want := model.OrderStatusInvalid
+		if i%2 == 0 {
+			want = model.OrderStatusProcessed
+		}
+		if got.Status != want {
+			t.Errorf("order %d status = %s, want %s", order.ID, got.Status, want)
+		}
+	}
+}
+
+func testOrderCreateManyEvents(t *testing.T, repos *repository.Repositories, store outbox.Store) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-bulk-events")
+	createOrder(t, repos, userID, "79927398713")
+
+	orders := []*model.Order{
+		{UserID: userID, Number: "79927398713", Status: model.OrderStatusNew},
+		{UserID: userID, Number: "12345678903", Status: model.OrderStatusNew},
+	}
+	if _, err := repos.Orders.CreateMany(ctx, orders); err != nil {
+		t.Fatalf("CreateMany failed: %v", err)
+	}
+
+	want := []orderEvent{{model.EventOrderStatusChanged, orders[1].ID, model.OrderStatusNew}}
+	if got := claimOrderEvents(t, store, userID); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateMany recorded %v, want %v", got, want)
+	}
+}
+
+func testOrderImportEvents(t *testing.T, repos *repository.Repositories, store outbox.Store) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "orders-import-events")
+
+	orders := []*model.Order{
+		{UserID: userID, Number: "79927398713", Status: model.OrderStatusProcessed, Accrual: 500},
+		{UserID: userID, Number: "12345678903", Status: model.OrderStatusInvalid},
+	}
+	if _, err := repos.Orders.Import(ctx, orders); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	want := []orderEvent{
+		{model.EventOrderStatusChanged, orders[0].ID, model.OrderStatusProcessed},
+		{model.EventOrderProcessed, orders[0].ID, model.OrderStatusProcessed},
+		{model.EventOrderStatusChanged, orders[1].ID, model.OrderStatusInvalid},
+	}
+	if got := claimOrderEvents(t, store, userID); !reflect.DeepEqual(got, want) {
+		t.Errorf("Import recorded %v, want %v", got, want)
+	}
+}
+
+// orderEvent is what the event tests compare of a recorded order event
+type orderEvent struct {
+	Type    model.EventType
+	OrderID int64
+	Status  model.OrderStatus
+}
+
+// claimOrderEvents returns the pending order events of the user in the order they occurred
+func claimOrderEvents(t *testing.T, store outbox.Store, userID int64) []orderEvent {
+	t.Helper()
+	events, err := store.ClaimBatch(context.Background(), 1000, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimBatch failed: %v", err)
+	}
+
+	var got []orderEvent
+	for _, event := range events {
+		if event.UserID != userID {
+			continue
+		}
+		var payload model.OrderEventPayload
+		if err := event.Decode(&payload); err != nil {
+			t.Fatalf("Failed to decode %s event: %v", event.Type, err)
+		}
+		got = append(got, orderEvent{event.Type, payload.OrderID, payload.Status})
+	}
+	return got
+}
+
+func createUser(t *testing.T, repos *repository.Repositories, login string) int64 {
+	t.Helper()
+	user := &model.User{Login: login, Password: "hash"}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user %s: %v", login, err)
+	}
+	return user.ID
+}
+
+func createOrder(t *testing.T, repos *repository.Repositories, userID int64, number string) *model.Order {
+	t.Helper()
+	order := &model.Order{UserID: userID, Number: number, Status: model.OrderStatusNew}
+	if err := repos.Orders.Create(context.Background(), order); err != nil {
+		t.Fatalf("Failed to create order %s: %v", number, err)
+	}
+	return order
+}
+
+func orderIDs(orders []*model.Order) []int64 {
+	ids := make([]int64, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	return ids
+}
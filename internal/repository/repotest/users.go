@@ -0,0 +1,73 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+// RunUserRepositoryTests checks that the backend's users behave like the reference implementation
+func RunUserRepositoryTests(t *testing.T, newRepos Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		testUserCreateAndGet(t, newRepos(t))
+	})
+	t.Run("LoginIsCaseInsensitive", func(t *testing.T) {
+		testUserLoginCase(t, newRepos(t))
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		testUserNotFound(t, newRepos(t))
+	})
+}
+
+func testUserCreateAndGet(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "users-create")
+
+	byID, err := repos.Users.GetByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if byID.Login != "users-create" || byID.CreatedAt.IsZero() {
+		t.Errorf("GetByID returned %+v", byID)
+	}
+
+	byLogin, err := repos.Users.GetByLogin(ctx, "users-create")
+	if err != nil {
+		t.Fatalf("GetByLogin failed: %v", err)
+	}
+	if byLogin.ID != userID {
+		t.Errorf("GetByLogin returned user %d, want %d", byLogin.ID, userID)
+	}
+}
+
+func testUserLoginCase(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "Gopher")
+
+	err := repos.Users.Create(ctx, &model.User{Login: "gOPHER", Password: "hash"})
+	if !errors.Is(err, repository.ErrUserExists) {
+		t.Errorf("Create with different case: got %v, want %v", err, repository.ErrUserExists)
+	}
+
+	user, err := repos.Users.GetByLogin(ctx, "gopher")
+	if err != nil {
+		t.Fatalf("GetByLogin failed: %v", err)
+	}
+	if user.ID != userID || user.Login != "Gopher" {
+		t.Errorf("GetByLogin returned %d %q, want %d %q", user.ID, user.Login, userID, "Gopher")
+	}
+}
+
+func testUserNotFound(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+
+	if _, err := repos.Users.GetByID(ctx, 999999); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByID: got %v, want %v", err, repository.ErrUserNotFound)
+	}
+	if _, err := repos.Users.GetByLogin(ctx, "nobody"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetByLogin: got %v, want %v", err, repository.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,220 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+// RunWithdrawalRepositoryTests checks that the backend's withdrawals and balances behave like the reference implementation
+func RunWithdrawalRepositoryTests(t *testing.T, newRepos Factory) {
+	t.Run("CreateAndList", func(t *testing.T) {
+		testWithdrawalCreateAndList(t, newRepos(t))
+	})
+	t.Run("DuplicateOrder", func(t *testing.T) {
+		testWithdrawalDuplicateOrder(t, newRepos(t))
+	})
+	t.Run("Balance", func(t *testing.T) {
+		testWithdrawalBalance(t, newRepos(t))
+	})
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		testWithdrawalInsufficientFunds(t, newRepos(t))
+	})
+	t.Run("UnknownUser", func(t *testing.T) {
+		testWithdrawalUnknownUser(t, newRepos(t))
+	})
+	t.Run("ConcurrentWithdrawals", func(t *testing.T) {
+		testWithdrawalConcurrent(t, newRepos(t))
+	})
+}
+
+func testWithdrawalCreateAndList(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "withdrawals-list")
+	otherID := createUser(t, repos, "withdrawals-list-other")
+	accrue(t, repos, userID, "4561261212345467", 1000)
+	accrue(t, repos, otherID, "49927398716", 1000)
+
+	var want []int64
+	for _, number := range []string{"2377225624", "12345678903", "79927398713"} {
+		withdrawal := createWithdrawal(t, repos, userID, number, 100)
+		if withdrawal.ID == 0 {
+			t.Fatal("expected withdrawal ID to be assigned")
+		}
+		if withdrawal.ProcessedAt.IsZero() {
+			t.Fatal("expected processed_at to be set")
+		}
+		want = append([]int64{withdrawal.ID}, want...)
+		// Keep processing times apart so the ordering is unambiguous
+		time.Sleep(5 * time.Millisecond)
+	}
+	createWithdrawal(t, repos, otherID, "378282246310005", 100)
+
+	withdrawals, err := repos.Withdrawals.GetByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if got := withdrawalIDs(withdrawals); !reflect.DeepEqual(got, want) {
+		t.Errorf("got withdrawals %v, want %v newest first", got, want)
+	}
+	for _, withdrawal := range withdrawals {
+		if withdrawal.UserID != userID || withdrawal.Sum != 100 {
+			t.Errorf("got %+v, want a withdrawal of 100 by user %d", withdrawal, userID)
+		}
+	}
+
+	empty := createUser(t, repos, "withdrawals-list-empty")
+	withdrawals, err = repos.Withdrawals.GetByUserID(ctx, empty)
+	if err != nil {
+		t.Fatalf("GetByUserID failed: %v", err)
+	}
+	if len(withdrawals) != 0 {
+		t.Errorf("got %d withdrawals for a user without any, want none", len(withdrawals))
+	}
+}
+
+func testWithdrawalDuplicateOrder(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "withdrawals-duplicate")
+	accrue(t, repos, userID, "4561261212345467", 1000)
+
+	createWithdrawal(t, repos, userID, "2377225624", 100)
+
+	err := repos.Withdrawals.Create(ctx, &model.Withdrawal{UserID: userID, OrderNumber: "2377225624", Sum: 50})
+	if !errors.Is(err, repository.ErrWithdrawalExists) {
+		t.Errorf("got %v, want %v", err, repository.ErrWithdrawalExists)
+	}
+
+	balance, err := repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Withdrawn != 100 {
+		t.Errorf("rejected withdrawal must not be stored, withdrawn = %v, want 100", balance.Withdrawn)
+	}
+}
+
+func testWithdrawalBalance(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "withdrawals-balance")
+
+	balance, err := repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if *balance != (model.Balance{}) {
+		t.Errorf("new user balance = %+v, want zero", *balance)
+	}
+
+	accrue(t, repos, userID, "4561261212345467", 500.5)
+	accrue(t, repos, userID, "49927398716", 250)
+	// Only processed orders count towards the balance
+	pending := createOrder(t, repos, userID, "1234567812345670")
+	if err := repos.Orders.UpdateStatus(ctx, pending.ID, model.OrderStatusProcessing); err != nil {
+		t.Fatalf("UpdateStatus failed: %v", err)
+	}
+	createWithdrawal(t, repos, userID, "2377225624", 200.25)
+
+	balance, err = repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	want := model.Balance{Current: 550.25, Withdrawn: 200.25}
+	if *balance != want {
+		t.Errorf("balance = %+v, want %+v", *balance, want)
+	}
+}
+
+func testWithdrawalInsufficientFunds(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "withdrawals-overdraft")
+	accrue(t, repos, userID, "4561261212345467", 100)
+
+	err := repos.Withdrawals.Create(ctx, &model.Withdrawal{UserID: userID, OrderNumber: "2377225624", Sum: 100.01})
+	if !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("overdraft: got %v, want %v", err, repository.ErrInsufficientFunds)
+	}
+
+	// Spending the whole balance is fine
+	createWithdrawal(t, repos, userID, "12345678903", 100)
+
+	balance, err := repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if want := (model.Balance{Current: 0, Withdrawn: 100}); *balance != want {
+		t.Errorf("balance = %+v, want %+v", *balance, want)
+	}
+}
+
+func testWithdrawalUnknownUser(t *testing.T, repos *repository.Repositories) {
+	err := repos.Withdrawals.Create(context.Background(), &model.Withdrawal{UserID: 999999, OrderNumber: "2377225624", Sum: 0})
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want %v", err, repository.ErrUserNotFound)
+	}
+}
+
+func testWithdrawalConcurrent(t *testing.T, repos *repository.Repositories) {
+	ctx := context.Background()
+	userID := createUser(t, repos, "withdrawals-concurrent")
+	accrue(t, repos, userID, "4561261212345467", 100)
+
+	// Every withdrawal fits the balance on its own, only one fits in total
+	numbers := []string{"2377225624", "12345678903", "79927398713", "49927398716", "1234567812345670"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(numbers))
+	for i, number := range numbers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = repos.Withdrawals.Create(ctx, &model.Withdrawal{UserID: userID, OrderNumber: number, Sum: 60})
+		}()
+	}
+	wg.Wait()
+
+	var succeeded int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, repository.ErrInsufficientFunds):
+			t.Errorf("withdrawal %s: %v", numbers[i], err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d withdrawals succeeded, want 1", succeeded)
+	}
+}
+
+// accrue adds a processed order worth amount points
+func accrue(t *testing.T, repos *repository.Repositories, userID int64, number string, amount float64) {
+	t.Helper()
+	order := createOrder(t, repos, userID, number)
+	if err := repos.Orders.UpdateAccrual(context.Background(), order.ID, amount, model.OrderStatusProcessed); err != nil {
+		t.Fatalf("Failed to accrue %v points on order %s: %v", amount, number, err)
+	}
+}
+
+func createWithdrawal(t *testing.T, repos *repository.Repositories, userID int64, number string, sum float64) *model.Withdrawal {
+	t.Helper()
+	withdrawal := &model.Withdrawal{UserID: userID, OrderNumber: number, Sum: sum}
+	if err := repos.Withdrawals.Create(context.Background(), withdrawal); err != nil {
+		t.Fatalf("Failed to create withdrawal for order %s: %v", number, err)
+	}
+	return withdrawal
+}
+
+func withdrawalIDs(withdrawals []*model.Withdrawal) []int64 {
+	ids := make([]int64, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		ids[i] = withdrawal.ID
+	}
+	return ids
+}
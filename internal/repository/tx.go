@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+// DBTX is the subset of *sql.DB and *sql.Tx the PostgreSQL repositories use,
+// so the same repository code runs standalone or inside a unit of work.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Repositories is the set of repositories bound to one transaction
+type Repositories struct {
+	Users       *UserRepository
+	Orders      *OrderRepository
+	Withdrawals *WithdrawalRepository
+}
+
+// Transactor runs a function with repositories sharing a single transaction.
+// The transaction commits when fn returns nil and rolls back otherwise.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error
+}
+
+// TxManager is the PostgreSQL Transactor. Transactions run at serializable
+// isolation and are retried when PostgreSQL aborts them on a serialization
+// failure or deadlock, so fn must be safe to run more than once.
+type TxManager struct {
+	db         *sql.DB
+	timeout    time.Duration
+	maxRetries int
+}
+
+func NewTxManager(db *sql.DB, queryTimeout time.Duration) *TxManager {
+	return &TxManager{
+		db:         db,
+		timeout:    queryTimeout,
+		maxRetries: 3,
+	}
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	return withRetries(ctx, m.maxRetries, func() error {
+		return m.run(ctx, fn)
+	})
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repos := &Repositories{
+		Users:       &UserRepository{Impl: &PostgresUserRepository{db: tx, timeout: m.timeout}},
+		Orders:      &OrderRepository{Impl: &PostgresOrderRepository{db: tx, timeout: m.timeout}},
+		Withdrawals: &WithdrawalRepository{Impl: &PostgresWithdrawalRepository{db: tx, timeout: m.timeout}},
+	}
+
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// withRetries runs a transaction again while PostgreSQL aborts it
+// on a serialization failure or deadlock
+func withRetries(ctx context.Context, maxRetries int, run func() error) error {
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+			}
+		}
+
+		err = run()
+		if !isRetryable(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("transaction failed after %d retries: %w", maxRetries, err)
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected
+}
+
+// runInTx runs fn in a transaction of its own unless db already is one,
+// keeping multi-statement repository methods atomic in both cases.
+func runInTx(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
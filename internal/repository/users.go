@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -17,15 +18,45 @@ var (
 	ErrUserExists   = errors.New("user already exists")
 )
 
+type UserRepositoryInterface interface {
+	Create(ctx context.Context, user *model.User) error
+	GetByLogin(ctx context.Context, login string) (*model.User, error)
+	GetByID(ctx context.Context, id int64) (*model.User, error)
+}
+
 type UserRepository struct {
-	db *sql.DB
+	Impl UserRepositoryInterface
+}
+
+func NewUserRepository(db *sql.DB, queryTimeout time.Duration) *UserRepository {
+	return &UserRepository{Impl: &PostgresUserRepository{db: db, timeout: queryTimeout}}
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// Create delegates to the implementation
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	return r.Impl.Create(ctx, user)
 }
 
-func (r *UserRepository) Create(user *model.User) error {
+// GetByLogin delegates to the implementation
+func (r *UserRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	return r.Impl.GetByLogin(ctx, login)
+}
+
+// GetByID delegates to the implementation
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	return r.Impl.GetByID(ctx, id)
+}
+
+// PostgresUserRepository is the PostgreSQL implementation of UserRepositoryInterface
+type PostgresUserRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+func (r *PostgresUserRepository) Create(ctx context.Context, user *model.User) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `INSERT INTO users (login, password, created_at, updated_at) 
               VALUES ($1, $2, $3, $4) 
               RETURNING id`
@@ -34,7 +65,7 @@ func (r *UserRepository) Create(user *model.User) error {
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	err := r.db.QueryRow(query, user.Login, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+	err := r.db.QueryRowContext(ctx, query, user.Login, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
@@ -46,13 +77,16 @@ func (r *UserRepository) Create(user *model.User) error {
 	return nil
 }
 
-func (r *UserRepository) GetByLogin(login string) (*model.User, error) {
+func (r *PostgresUserRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `SELECT id, login, password, created_at, updated_at, deleted_at 
               FROM users 
-              WHERE login = $1 AND deleted_at IS NULL`
+              WHERE LOWER(login) = LOWER($1) AND deleted_at IS NULL`
 
 	user := &model.User{}
-	err := r.db.QueryRow(query, login).Scan(
+	err := r.db.QueryRowContext(ctx, query, login).Scan(
 		&user.ID,
 		&user.Login,
 		&user.Password,
@@ -71,13 +105,16 @@ func (r *UserRepository) GetByLogin(login string) (*model.User, error) {
 	return user, nil
 }
 
-func (r *UserRepository) GetByID(id int64) (*model.User, error) {
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `SELECT id, login, password, created_at, updated_at, deleted_at 
               FROM users 
               WHERE id = $1 AND deleted_at IS NULL`
 
 	user := &model.User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Login,
 		&user.Password,
@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryInFlight = errors.New("webhook delivery is being sent")
+)
+
+// webhookPayload is the body sent to webhook subscribers
+type webhookPayload struct {
+	Event     model.WebhookEvent `json:"event"`
+	CreatedAt time.Time          `json:"created_at"`
+	Data      interface{}        `json:"data"`
+}
+
+type WebhookRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+func NewWebhookRepository(db *sql.DB, queryTimeout time.Duration) *WebhookRepository {
+	return &WebhookRepository{db: db, timeout: queryTimeout}
+}
+
+// EnqueueForEvent queues a delivery of the event for every matching webhook
+// of the user. Deliveries are keyed by the outbox event, so handling the same
+// event twice does not notify subscribers twice.
+func (r *WebhookRepository) EnqueueForEvent(ctx context.Context, eventID, userID int64, event model.WebhookEvent, data interface{}) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	payload, err := json.Marshal(webhookPayload{
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, outbox_event_id, event_type, payload)
+              SELECT id, $1, $3::text, $4::jsonb
+              FROM webhooks
+              WHERE user_id = $2 AND $3::text = ANY(event_types)
+              ON CONFLICT (webhook_id, outbox_event_id) DO NOTHING`
+
+	if _, err := r.db.ExecContext(ctx, query, eventID, userID, string(event), string(payload)); err != nil {
+		return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// Create registers a new webhook subscription
+func (r *WebhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO webhooks (user_id, url, secret, event_types, created_at)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id`
+
+	var eventTypes pgtype.TextArray
+	if err := eventTypes.Set(eventStrings(webhook.Events)); err != nil {
+		return fmt.Errorf("failed to encode event types: %w", err)
+	}
+
+	webhook.CreatedAt = time.Now()
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		&eventTypes,
+		webhook.CreatedAt,
+	).Scan(&webhook.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return nil
+}
+
+// GetByUserID retrieves all webhooks of a user
+func (r *WebhookRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, url, secret, event_types, created_at
+              FROM webhooks
+              WHERE user_id = $1
+              ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*model.Webhook
+	for rows.Next() {
+		webhook := &model.Webhook{}
+		var eventTypes pgtype.TextArray
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			&eventTypes,
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+
+		var events []string
+		if err := eventTypes.AssignTo(&events); err != nil {
+			return nil, fmt.Errorf("failed to decode event types: %w", err)
+		}
+		for _, event := range events {
+			webhook.Events = append(webhook.Events, model.WebhookEvent(event))
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes a webhook of the user together with its deliveries
+func (r *WebhookRepository) Delete(ctx context.Context, userID, id int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// GetDeliveries retrieves the most recent deliveries of all webhooks of a user
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, userID int64, limit int) ([]*model.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts,
+                     d.next_attempt_at, d.last_error, d.created_at, d.delivered_at
+              FROM webhook_deliveries d
+              JOIN webhooks w ON w.id = d.webhook_id
+              WHERE w.user_id = $1
+              ORDER BY d.created_at DESC
+              LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		delivery := &model.WebhookDelivery{}
+		var payload string
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDue locks pending deliveries that are due and pushes their next attempt
+// out by the lease, so other dispatchers skip them while they are in flight.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `WITH due AS (
+                  SELECT id FROM webhook_deliveries
+                  WHERE status = $1 AND next_attempt_at <= NOW()
+                  ORDER BY next_attempt_at
+                  LIMIT $2
+                  FOR UPDATE SKIP LOCKED
+              ), claimed AS (
+                  UPDATE webhook_deliveries d
+                  SET next_attempt_at = NOW() + make_interval(secs => $3)
+                  FROM due
+                  WHERE d.id = due.id
+                  RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, d.created_at
+              )
+              SELECT c.id, c.webhook_id, c.event_type, c.payload, c.attempts, c.created_at, w.url, w.secret
+              FROM claimed c
+              JOIN webhooks w ON w.id = c.webhook_id`
+
+	rows, err := r.db.QueryContext(ctx, query, model.DeliveryStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		delivery := &model.WebhookDelivery{Status: model.DeliveryStatusPending}
+		var payload string
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&payload,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered records a successful delivery
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id int64, attempts int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries
+              SET status = $1, attempts = $2, delivered_at = NOW(), last_error = NULL
+              WHERE id = $3`
+
+	if _, err := r.db.ExecContext(ctx, query, model.DeliveryStatusDelivered, attempts, id); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery delivered: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt and either schedules a retry or dead-letters the delivery
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, dead bool) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	status := model.DeliveryStatusPending
+	if dead {
+		status = model.DeliveryStatusDead
+	}
+
+	query := `UPDATE webhook_deliveries
+              SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4
+              WHERE id = $5`
+
+	if _, err := r.db.ExecContext(ctx, query, status, attempts, nextAttemptAt, lastError, id); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery failed: %w", err)
+	}
+
+	return nil
+}
+
+// Replay schedules a delivery of the user to be sent again immediately.
+// Pending deliveries not yet due are refused: ClaimDue pushes the next
+// attempt of the deliveries it hands out, so they may be in flight, and
+// resetting them would have them claimed and sent a second time.
+func (r *WebhookRepository) Replay(ctx context.Context, userID, deliveryID int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d
+              SET status = $1, attempts = 0, next_attempt_at = NOW(), delivered_at = NULL, last_error = NULL
+              FROM webhooks w
+              WHERE w.id = d.webhook_id AND d.id = $2 AND w.user_id = $3
+                AND (d.status <> $1 OR d.next_attempt_at <= NOW())`
+
+	result, err := r.db.ExecContext(ctx, query, model.DeliveryStatusPending, deliveryID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to replay webhook delivery: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	existsQuery := `SELECT EXISTS (
+                        SELECT 1 FROM webhook_deliveries d
+                        JOIN webhooks w ON w.id = d.webhook_id
+                        WHERE d.id = $1 AND w.user_id = $2
+                    )`
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, existsQuery, deliveryID, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check webhook delivery: %w", err)
+	}
+
+	if exists {
+		return ErrDeliveryInFlight
+	}
+
+	return ErrDeliveryNotFound
+}
+
+func eventStrings(events []model.WebhookEvent) []string {
+	result := make([]string, len(events))
+	for i, event := range events {
+		result[i] = string(event)
+	}
+	return result
+}
@@ -1 +1,177 @@
 package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+
+	"github.com/riouske/gophermart/internal/model"
+)
+
+var (
+	ErrWithdrawalExists  = errors.New("withdrawal for this order already exists")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+type WithdrawalRepositoryInterface interface {
+	Create(ctx context.Context, withdrawal *model.Withdrawal) error
+	GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error)
+	GetBalance(ctx context.Context, userID int64) (*model.Balance, error)
+}
+
+type WithdrawalRepository struct {
+	Impl WithdrawalRepositoryInterface
+	db   *sql.DB
+}
+
+func NewWithdrawalRepository(db *sql.DB, queryTimeout time.Duration) *WithdrawalRepository {
+	repo := &WithdrawalRepository{db: db}
+	repo.Impl = &PostgresWithdrawalRepository{db: db, timeout: queryTimeout}
+	return repo
+}
+
+// Create delegates to the implementation
+func (r *WithdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
+	return r.Impl.Create(ctx, withdrawal)
+}
+
+// GetByUserID delegates to the implementation
+func (r *WithdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	return r.Impl.GetByUserID(ctx, userID)
+}
+
+// GetBalance delegates to the implementation
+func (r *WithdrawalRepository) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	return r.Impl.GetBalance(ctx, userID)
+}
+
+// PostgresWithdrawalRepository is the PostgreSQL implementation of WithdrawalRepositoryInterface
+type PostgresWithdrawalRepository struct {
+	db      DBTX
+	timeout time.Duration
+}
+
+// lockUserQuery serializes the withdrawals of a user, so that two of them
+// cannot both pass the balance check before either is recorded
+const lockUserQuery = `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+
+const balanceQuery = `SELECT
+                COALESCE((SELECT SUM(accrual) FROM orders WHERE user_id = $1 AND status = 'PROCESSED'), 0),
+                COALESCE((SELECT SUM(sum) FROM withdrawals WHERE user_id = $1), 0)`
+
+// Create records a withdrawal together with its outbox event. It fails with
+// ErrInsufficientFunds when the balance does not cover the sum and with
+// ErrUserNotFound when the user does not exist.
+func (r *PostgresWithdrawalRepository) Create(ctx context.Context, withdrawal *model.Withdrawal) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return runInTx(ctx, r.db, func(tx DBTX) error {
+		var userID int64
+		if err := tx.QueryRowContext(ctx, lockUserQuery, withdrawal.UserID).Scan(&userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+
+		var accrued, withdrawn float64
+		if err := tx.QueryRowContext(ctx, balanceQuery, withdrawal.UserID).Scan(&accrued, &withdrawn); err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+		if accrued-withdrawn < withdrawal.Sum {
+			return ErrInsufficientFunds
+		}
+
+		query := `INSERT INTO withdrawals (user_id, order_number, sum, processed_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id`
+
+		withdrawal.ProcessedAt = time.Now()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			withdrawal.UserID,
+			withdrawal.OrderNumber,
+			withdrawal.Sum,
+			withdrawal.ProcessedAt,
+		).Scan(&withdrawal.ID)
+
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return ErrWithdrawalExists
+			}
+			return fmt.Errorf("failed to create withdrawal: %w", err)
+		}
+
+		payload := model.WithdrawalEventPayload{
+			WithdrawalID: withdrawal.ID,
+			Order:        withdrawal.OrderNumber,
+			Sum:          withdrawal.Sum,
+			ProcessedAt:  withdrawal.ProcessedAt,
+		}
+		return appendEvent(ctx, tx, model.EventWithdrawalMade, withdrawal.UserID, payload)
+	})
+}
+
+// GetByUserID retrieves all withdrawals for a specific user
+func (r *PostgresWithdrawalRepository) GetByUserID(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, order_number, sum, processed_at
+              FROM withdrawals
+              WHERE user_id = $1
+              ORDER BY processed_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var withdrawals []*model.Withdrawal
+	for rows.Next() {
+		withdrawal := &model.Withdrawal{}
+		err := rows.Scan(
+			&withdrawal.ID,
+			&withdrawal.UserID,
+			&withdrawal.OrderNumber,
+			&withdrawal.Sum,
+			&withdrawal.ProcessedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating withdrawals rows: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+// GetBalance calculates the current and withdrawn points of a user
+func (r *PostgresWithdrawalRepository) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var accrued, withdrawn float64
+	if err := r.db.QueryRowContext(ctx, balanceQuery, userID).Scan(&accrued, &withdrawn); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	return &model.Balance{
+		Current:   accrued - withdrawn,
+		Withdrawn: withdrawn,
+	}, nil
+}
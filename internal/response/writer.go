@@ -0,0 +1,85 @@
+// Package response wraps http.ResponseWriter for middleware that reports
+// on the response, like the access log and the metrics.
+package response
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Writer records the status code and the number of body bytes written
+// through it. It keeps hijacking and flushing working for the handlers.
+type Writer struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// Wrap wraps w, or returns it as is when an outer middleware already
+// wrapped it, so that the whole stack shares one recorder
+func Wrap(w http.ResponseWriter) *Writer {
+	if rw, ok := w.(*Writer); ok {
+		return rw
+	}
+	return &Writer{ResponseWriter: w}
+}
+
+func (w *Writer) WriteHeader(status int) {
+	// Informational replies are followed by the final one
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status is the status code sent, 0 while nothing has been written
+func (w *Writer) Status() int {
+	return w.status
+}
+
+// BytesWritten is the size of the body written so far
+func (w *Writer) BytesWritten() int64 {
+	return w.bytes
+}
+
+// Written reports whether the status line has been sent
+func (w *Writer) Written() bool {
+	return w.status != 0
+}
+
+// Hijack hands the connection over, for WebSocket upgrades
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *Writer) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,79 @@
+package response_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/response"
+)
+
+func TestWriter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rw := response.Wrap(rr)
+	if response.Wrap(rw) != rw {
+		t.Error("Expected an already wrapped writer to be reused")
+	}
+	if rw.Written() {
+		t.Error("Expected nothing written yet")
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write([]byte("hello"))
+	rw.WriteHeader(http.StatusInternalServerError)
+
+	if rw.Status() != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rw.Status())
+	}
+	if rw.BytesWritten() != 5 {
+		t.Errorf("Expected 5 bytes, got %d", rw.BytesWritten())
+	}
+}
+
+func TestWriter_ImplicitStatus(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rw := response.Wrap(rr)
+	rw.Write([]byte("hello"))
+
+	if rw.Status() != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rw.Status())
+	}
+
+	rw = response.Wrap(httptest.NewRecorder())
+	rw.Flush()
+	if rw.Status() != http.StatusOK {
+		t.Errorf("Expected flushing to send status %d, got %d", http.StatusOK, rw.Status())
+	}
+}
+
+// hijackRecorder is a ResponseRecorder that supports hijacking
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestWriter_Hijack(t *testing.T) {
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rw := response.Wrap(hr)
+
+	if _, _, err := rw.Hijack(); err != nil {
+		t.Fatalf("Hijack failed: %v", err)
+	}
+	if !hr.hijacked {
+		t.Error("Expected the underlying writer to be hijacked")
+	}
+	if rw.Status() != http.StatusSwitchingProtocols {
+		t.Errorf("Expected status %d, got %d", http.StatusSwitchingProtocols, rw.Status())
+	}
+
+	if _, _, err := response.Wrap(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Error("Expected an error from a writer that cannot be hijacked")
+	}
+}
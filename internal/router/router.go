@@ -0,0 +1,148 @@
+// Package router maps method and path patterns to handlers on top of the
+// Go 1.22 http.ServeMux. The mux extracts path parameters, available to
+// handlers through r.PathValue, and answers 405 with an Allow header when
+// a path exists for other methods only. Both are sent as problem+json
+// documents like every other error of the API.
+package router
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+)
+
+// Middleware wraps a handler, like middleware.Auth
+type Middleware func(next http.Handler) http.Handler
+
+// Route is one entry of the route table
+type Route struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+}
+
+// Router registers routes on a shared mux. Groups made with Group share the
+// mux and the route table but add a path prefix and middleware of their own.
+type Router struct {
+	mux        *http.ServeMux
+	routes     *[]Route
+	prefix     string
+	middleware []Middleware
+}
+
+func New() *Router {
+	return &Router{
+		mux:    http.NewServeMux(),
+		routes: &[]Route{},
+	}
+}
+
+// Group returns a router registering its routes under prefix, wrapped in
+// the given middleware after the parent's
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		mux:        r.mux,
+		routes:     r.routes,
+		prefix:     r.prefix + prefix,
+		middleware: append(append([]Middleware{}, r.middleware...), middleware...),
+	}
+}
+
+// Handle registers handler for method and path. The path may hold
+// {name} wildcards as understood by http.ServeMux.
+func (r *Router) Handle(method, path string, handler http.Handler) {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+
+	pattern := r.prefix + path
+	r.mux.Handle(method+" "+pattern, handler)
+	*r.routes = append(*r.routes, Route{Method: method, Pattern: pattern})
+}
+
+func (r *Router) Get(path string, handler http.Handler) {
+	r.Handle(http.MethodGet, path, handler)
+}
+
+func (r *Router) Post(path string, handler http.Handler) {
+	r.Handle(http.MethodPost, path, handler)
+}
+
+func (r *Router) Delete(path string, handler http.Handler) {
+	r.Handle(http.MethodDelete, path, handler)
+}
+
+// Routes lists every registered route ordered by pattern and method
+func (r *Router) Routes() []Route {
+	routes := append([]Route{}, *r.routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Handler reports the handler and the "METHOD /path" pattern the request
+// would be dispatched to, the pattern being empty when nothing matches
+func (r *Router) Handler(req *http.Request) (http.Handler, string) {
+	return r.mux.Handler(req)
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	handler, pattern := r.mux.Handler(req)
+	if pattern == "" {
+		r.unmatched(w, req, handler)
+		return
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// unmatched replaces the plain text 404 and 405 replies of the mux with
+// problems, keeping the Allow header the mux computes for a 405
+func (r *Router) unmatched(w http.ResponseWriter, req *http.Request, handler http.Handler) {
+	rec := &headerRecorder{header: make(http.Header)}
+	handler.ServeHTTP(rec, req)
+
+	if allow := rec.header.Get("Allow"); rec.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", allow)
+		problem.Respond(w, req, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+			"Method "+req.Method+" is not allowed, use one of "+allow)
+		return
+	}
+	problem.Respond(w, req, http.StatusNotFound, problem.CodeNotFound, "No route matches "+req.URL.Path)
+}
+
+// headerRecorder keeps the status and headers of a reply and drops its body
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *headerRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *headerRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *headerRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+// TableHandler serves the route table as JSON, for docs and debugging
+func (r *Router) TableHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(r.Routes()); err != nil {
+			slog.ErrorContext(req.Context(), "Failed to encode routes", "error", err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/problem"
+)
+
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Middleware", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Method + " " + r.PathValue("number")))
+}
+
+func TestRouter(t *testing.T) {
+	routes := New()
+	routes.Get("/healthz", http.HandlerFunc(echo))
+
+	api := routes.Group("/api", tag("api"))
+	user := api.Group("/user", tag("auth"))
+	user.Get("/orders", http.HandlerFunc(echo))
+	user.Post("/orders", http.HandlerFunc(echo))
+	user.Get("/orders/{number}", http.HandlerFunc(echo))
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		expectedCode  int
+		expectedBody  string
+		expectedAllow string
+		expectedChain []string
+	}{
+		{
+			name:          "Grouped route runs middleware outermost first",
+			method:        http.MethodPost,
+			path:          "/api/user/orders",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "POST ",
+			expectedChain: []string{"api", "auth"},
+		},
+		{
+			name:          "Path parameter",
+			method:        http.MethodGet,
+			path:          "/api/user/orders/12345678903",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "GET 12345678903",
+			expectedChain: []string{"api", "auth"},
+		},
+		{
+			name:          "Wrong method",
+			method:        http.MethodDelete,
+			path:          "/api/user/orders",
+			expectedCode:  http.StatusMethodNotAllowed,
+			expectedAllow: "GET, HEAD, POST",
+		},
+		{
+			name:         "Unknown path",
+			method:       http.MethodGet,
+			path:         "/api/user/unknown",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Ungrouped route",
+			method:       http.MethodGet,
+			path:         "/healthz",
+			expectedCode: http.StatusOK,
+			expectedBody: "GET ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if tt.expectedAllow != "" && rr.Header().Get("Allow") != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, rr.Header().Get("Allow"))
+			}
+			if chain := rr.Header().Values("X-Middleware"); tt.expectedChain != nil && !reflect.DeepEqual(chain, tt.expectedChain) {
+				t.Errorf("Expected middleware %v, got %v", tt.expectedChain, chain)
+			}
+			if rr.Code >= http.StatusBadRequest && rr.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("Expected a problem, got Content-Type %q", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("Route table", func(t *testing.T) {
+		expected := []Route{
+			{Method: http.MethodGet, Pattern: "/api/user/orders"},
+			{Method: http.MethodPost, Pattern: "/api/user/orders"},
+			{Method: http.MethodGet, Pattern: "/api/user/orders/{number}"},
+			{Method: http.MethodGet, Pattern: "/healthz"},
+		}
+		if got := routes.Routes(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected routes %v, got %v", expected, got)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.TableHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/routes", nil))
+		if !strings.Contains(rr.Body.String(), `{"method":"GET","pattern":"/api/user/orders/{number}"}`) {
+			t.Errorf("Route table is missing the order route: %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Pattern lookup", func(t *testing.T) {
+		_, pattern := routes.Handler(httptest.NewRequest(http.MethodGet, "/api/user/orders/42", nil))
+		if pattern != "GET /api/user/orders/{number}" {
+			t.Errorf("Expected the order pattern, got %q", pattern)
+		}
+	})
+}
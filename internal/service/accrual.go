@@ -1 +1,249 @@
 package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/riouske/gophermart/internal/metrics"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/tracing"
+)
+
+var (
+	ErrAccrualOrderNotRegistered = errors.New("order is not registered in accrual system")
+)
+
+// Statuses reported by the accrual system
+const (
+	AccrualStatusRegistered = "REGISTERED"
+	AccrualStatusInvalid    = "INVALID"
+	AccrualStatusProcessing = "PROCESSING"
+	AccrualStatusProcessed  = "PROCESSED"
+)
+
+// RateLimitError is returned when the accrual system asks to slow down
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual system rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// AccrualResponse is the accrual system view of an order
+type AccrualResponse struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+type AccrualClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewAccrualClient(baseURL string) *AccrualClient {
+	return &AccrualClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			// Sends traceparent so the accrual system can join our traces
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+}
+
+// GetOrder fetches the accrual calculation for the order number
+func (c *AccrualClient) GetOrder(ctx context.Context, number string) (*AccrualResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/orders/"+url.PathEscape(number), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.ObserveAccrualRequest(0, time.Since(start))
+		return nil, fmt.Errorf("failed to request accrual system: %w", err)
+	}
+	defer resp.Body.Close()
+	metrics.ObserveAccrualRequest(resp.StatusCode, time.Since(start))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var accrual AccrualResponse
+		if err := json.NewDecoder(resp.Body).Decode(&accrual); err != nil {
+			return nil, fmt.Errorf("failed to decode accrual response: %w", err)
+		}
+		return &accrual, nil
+	case http.StatusNoContent:
+		return nil, ErrAccrualOrderNotRegistered
+	case http.StatusTooManyRequests:
+		retryAfter := time.Minute
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	default:
+		return nil, fmt.Errorf("unexpected accrual system status: %d", resp.StatusCode)
+	}
+}
+
+// Ping checks that the accrual system answers at all. Any HTTP response
+// counts, since only unreachable hosts keep orders from being processed.
+func (c *AccrualClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL+"/", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("accrual system is unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// AccrualPoller periodically syncs unprocessed orders with the accrual system
+type AccrualPoller struct {
+	client       *AccrualClient
+	orderService *OrderService
+	interval     time.Duration
+	batchSize    int
+}
+
+func NewAccrualPoller(client *AccrualClient, orderService *OrderService, interval time.Duration) *AccrualPoller {
+	return &AccrualPoller{
+		client:       client,
+		orderService: orderService,
+		interval:     interval,
+		batchSize:    100,
+	}
+}
+
+// Run polls until the context is cancelled
+func (p *AccrualPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		wait := p.poll(ctx)
+		if wait > 0 {
+			slog.WarnContext(ctx, "Accrual system rate limited, pausing", "wait", wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll processes one batch of orders and returns how long to back off
+func (p *AccrualPoller) poll(ctx context.Context) time.Duration {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual.poll")
+	defer span.End()
+
+	// Orders are claimed until the next tick, so that the pollers of several
+	// instances share the work instead of each asking about every order
+	orders, err := p.orderService.ClaimUnprocessed(ctx, p.batchSize, p.interval)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "Failed to claim unprocessed orders", "error", err)
+		return 0
+	}
+	span.SetAttributes(attribute.Int("orders.count", len(orders)))
+
+	var lag time.Duration
+	if len(orders) > 0 {
+		lag = time.Since(orders[0].UploadedAt)
+	}
+	metrics.SetAccrualQueue(len(orders), lag)
+
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return 0
+		}
+
+		if wait := p.sync(ctx, order); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// sync fetches the accrual of one order and stores it, returning how long
+// to back off when the accrual system is rate limiting
+func (p *AccrualPoller) sync(ctx context.Context, order *model.Order) time.Duration {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual.sync_order",
+		trace.WithAttributes(attribute.String("order.number", order.Number)))
+	defer span.End()
+
+	accrual, err := p.client.GetOrder(ctx, order.Number)
+	if err != nil {
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			span.SetStatus(codes.Error, "rate limited")
+			return rateLimitErr.RetryAfter
+		}
+		if !errors.Is(err, ErrAccrualOrderNotRegistered) {
+			span.SetStatus(codes.Error, err.Error())
+			slog.ErrorContext(ctx, "Failed to get accrual", "order", order.Number, "error", err)
+		}
+		return 0
+	}
+
+	if err := p.apply(ctx, order, accrual); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "Failed to update order", "order", order.Number, "error", err)
+	}
+
+	return 0
+}
+
+// apply stores the accrual system result when the order status changed
+func (p *AccrualPoller) apply(ctx context.Context, order *model.Order, accrual *AccrualResponse) error {
+	var status model.OrderStatus
+	switch accrual.Status {
+	case AccrualStatusProcessing:
+		status = model.OrderStatusProcessing
+	case AccrualStatusInvalid:
+		status = model.OrderStatusInvalid
+	case AccrualStatusProcessed:
+		status = model.OrderStatusProcessed
+	default:
+		return nil
+	}
+
+	if status == order.Status {
+		return nil
+	}
+
+	var amount float64
+	if accrual.Accrual != nil {
+		amount = *accrual.Accrual
+	}
+
+	return p.orderService.ApplyAccrual(ctx, order.ID, status, amount)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+func TestAccrualClient_GetOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/orders/79927398713":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"order":"79927398713","status":"PROCESSED","accrual":729.98}`)
+		case "/api/orders/12345678903":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/orders/49927398716":
+			w.Header().Set("Retry-After", "42")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAccrualClient(server.URL + "/")
+	ctx := context.Background()
+
+	accrual, err := client.GetOrder(ctx, "79927398713")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accrual.Status != AccrualStatusProcessed || accrual.Accrual == nil || *accrual.Accrual != 729.98 {
+		t.Errorf("got %+v, want PROCESSED with 729.98", accrual)
+	}
+
+	if _, err := client.GetOrder(ctx, "12345678903"); !errors.Is(err, ErrAccrualOrderNotRegistered) {
+		t.Errorf("unregistered order: got %v, want %v", err, ErrAccrualOrderNotRegistered)
+	}
+
+	_, err = client.GetOrder(ctx, "49927398716")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("rate limited: got %v, want a *RateLimitError", err)
+	}
+	if rateLimitErr.RetryAfter != 42*time.Second {
+		t.Errorf("RetryAfter = %s, want 42s", rateLimitErr.RetryAfter)
+	}
+
+	if _, err := client.GetOrder(ctx, "2377225624"); err == nil {
+		t.Error("expected an error on a server error")
+	}
+}
+
+func TestAccrualPoller_Poll(t *testing.T) {
+	ctx := context.Background()
+	store, repos, userID := newTestStore(t, 0)
+
+	responses := map[string]string{
+		"79927398713": `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+		"12345678903": `{"order":"12345678903","status":"INVALID"}`,
+		"49927398716": `{"order":"49927398716","status":"PROCESSING"}`,
+		"2377225624":  `{"order":"2377225624","status":"REGISTERED"}`,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.PathValue("number")]
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	orders := make(map[string]*model.Order)
+	for _, number := range []string{"79927398713", "12345678903", "49927398716", "2377225624", "1234567812345670"} {
+		order := &model.Order{UserID: userID, Number: number, Status: model.OrderStatusNew}
+		if err := repos.Orders.Create(ctx, order); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		orders[number] = order
+	}
+
+	orderService := NewOrderService(repos.Orders, repository.NewMemoryTxManager(store))
+	poller := NewAccrualPoller(NewAccrualClient(server.URL), orderService, time.Second)
+
+	if wait := poller.poll(ctx); wait != 0 {
+		t.Fatalf("poll asked to back off for %s", wait)
+	}
+
+	want := map[string]model.OrderStatus{
+		"79927398713":      model.OrderStatusProcessed,
+		"12345678903":      model.OrderStatusInvalid,
+		"49927398716":      model.OrderStatusProcessing,
+		"2377225624":       model.OrderStatusNew,
+		"1234567812345670": model.OrderStatusNew,
+	}
+	for number, status := range want {
+		order, err := repos.Orders.GetByID(ctx, orders[number].ID)
+		if err != nil {
+			t.Fatalf("GetByID failed: %v", err)
+		}
+		if order.Status != status {
+			t.Errorf("order %s status = %s, want %s", number, order.Status, status)
+		}
+	}
+
+	balance, err := repos.Withdrawals.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Current != 500 {
+		t.Errorf("balance = %v, want the 500 accrued", balance.Current)
+	}
+}
+
+func TestAccrualPoller_RateLimited(t *testing.T) {
+	ctx := context.Background()
+	store, repos, userID := newTestStore(t, 0)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	for _, number := range []string{"79927398713", "12345678903"} {
+		if err := repos.Orders.Create(ctx, &model.Order{UserID: userID, Number: number, Status: model.OrderStatusNew}); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+	}
+
+	orderService := NewOrderService(repos.Orders, repository.NewMemoryTxManager(store))
+	poller := NewAccrualPoller(NewAccrualClient(server.URL), orderService, time.Second)
+
+	if wait := poller.poll(ctx); wait != 30*time.Second {
+		t.Errorf("poll backoff = %s, want 30s", wait)
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want the batch to stop at the first rate limit", requests)
+	}
+}
@@ -1,12 +1,14 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/riouske/gophermart/internal/metrics"
 	"github.com/riouske/gophermart/internal/model"
 	"github.com/riouske/gophermart/internal/repository"
 )
@@ -34,7 +36,7 @@ func NewAuthService(userRepo *repository.UserRepository, jwtSecret string) *Auth
 	}
 }
 
-func (s *AuthService) Register(credentials *model.UserCredentials) (*model.User, string, error) {
+func (s *AuthService) Register(ctx context.Context, credentials *model.UserCredentials) (*model.User, string, error) {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -46,7 +48,7 @@ func (s *AuthService) Register(credentials *model.UserCredentials) (*model.User,
 		Password: string(hashedPassword),
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, "", err
 	}
 
@@ -58,8 +60,21 @@ func (s *AuthService) Register(credentials *model.UserCredentials) (*model.User,
 	return user, token, nil
 }
 
-func (s *AuthService) Login(credentials *model.UserCredentials) (*model.User, string, error) {
-	user, err := s.userRepo.GetByLogin(credentials.Login)
+func (s *AuthService) Login(ctx context.Context, credentials *model.UserCredentials) (*model.User, string, error) {
+	user, token, err := s.login(ctx, credentials)
+	switch {
+	case err == nil:
+		metrics.ObserveLogin(metrics.LoginSuccess)
+	case errors.Is(err, ErrInvalidCredentials):
+		metrics.ObserveLogin(metrics.LoginFailure)
+	default:
+		metrics.ObserveLogin(metrics.LoginError)
+	}
+	return user, token, err
+}
+
+func (s *AuthService) login(ctx context.Context, credentials *model.UserCredentials) (*model.User, string, error) {
+	user, err := s.userRepo.GetByLogin(ctx, credentials.Login)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return nil, "", ErrInvalidCredentials
@@ -121,6 +136,6 @@ func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-func (s *AuthService) GetUserByID(userID int64) (*model.User, error) {
-	return s.userRepo.GetByID(userID)
+func (s *AuthService) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	return s.userRepo.GetByID(ctx, userID)
 }
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+var (
+	ErrInsufficientFunds = repository.ErrInsufficientFunds
+)
+
+type BalanceService struct {
+	withdrawalRepo *repository.WithdrawalRepository
+	tx             repository.Transactor
+}
+
+func NewBalanceService(withdrawalRepo *repository.WithdrawalRepository, tx repository.Transactor) *BalanceService {
+	return &BalanceService{
+		withdrawalRepo: withdrawalRepo,
+		tx:             tx,
+	}
+}
+
+func (s *BalanceService) GetBalance(ctx context.Context, userID int64) (*model.Balance, error) {
+	return s.withdrawalRepo.GetBalance(ctx, userID)
+}
+
+func (s *BalanceService) GetWithdrawals(ctx context.Context, userID int64) ([]*model.Withdrawal, error) {
+	return s.withdrawalRepo.GetByUserID(ctx, userID)
+}
+
+// Withdraw spends points of the user towards the given order
+func (s *BalanceService) Withdraw(ctx context.Context, userID int64, orderNumber string, sum float64) (*model.Withdrawal, error) {
+	withdrawal := &model.Withdrawal{
+		UserID:      userID,
+		OrderNumber: orderNumber,
+		Sum:         sum,
+	}
+
+	// Create checks the balance, and records the withdrawal with its
+	// outbox event, in the same transaction
+	err := s.tx.WithinTx(ctx, func(ctx context.Context, repos *repository.Repositories) error {
+		return repos.Withdrawals.Create(ctx, withdrawal)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return withdrawal, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+// newTestStore returns memory repositories holding a user with points to spend
+func newTestStore(t *testing.T, points float64) (*repository.MemoryStore, *repository.Repositories, int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	store := repository.NewMemoryStore()
+	repos := &repository.Repositories{
+		Users:       repository.NewMemoryUserRepository(store),
+		Orders:      repository.NewMemoryOrderRepository(store),
+		Withdrawals: repository.NewMemoryWithdrawalRepository(store),
+	}
+
+	user := &model.User{Login: "balance", Password: "hash"}
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if points > 0 {
+		order := &model.Order{UserID: user.ID, Number: "4561261212345467", Status: model.OrderStatusNew}
+		if err := repos.Orders.Create(ctx, order); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		if err := repos.Orders.UpdateAccrual(ctx, order.ID, points, model.OrderStatusProcessed); err != nil {
+			t.Fatalf("Failed to accrue points: %v", err)
+		}
+	}
+
+	return store, repos, user.ID
+}
+
+func TestBalanceService_Withdraw(t *testing.T) {
+	ctx := context.Background()
+	store, repos, userID := newTestStore(t, 500)
+	balanceService := NewBalanceService(repos.Withdrawals, repository.NewMemoryTxManager(store))
+
+	withdrawal, err := balanceService.Withdraw(ctx, userID, "2377225624", 200)
+	if err != nil {
+		t.Fatalf("unexpected withdrawal error: %v", err)
+	}
+	if withdrawal.ID == 0 || withdrawal.OrderNumber != "2377225624" || withdrawal.Sum != 200 {
+		t.Errorf("got withdrawal %+v, want 200 points on order 2377225624", withdrawal)
+	}
+
+	if _, err := balanceService.Withdraw(ctx, userID, "12345678903", 300.01); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("overdraft: got %v, want %v", err, ErrInsufficientFunds)
+	}
+	if _, err := balanceService.Withdraw(ctx, userID, "2377225624", 10); !errors.Is(err, repository.ErrWithdrawalExists) {
+		t.Errorf("same order again: got %v, want %v", err, repository.ErrWithdrawalExists)
+	}
+
+	balance, err := balanceService.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if want := (model.Balance{Current: 300, Withdrawn: 200}); *balance != want {
+		t.Errorf("balance = %+v, want %+v", *balance, want)
+	}
+
+	withdrawals, err := balanceService.GetWithdrawals(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetWithdrawals failed: %v", err)
+	}
+	if len(withdrawals) != 1 || withdrawals[0].ID != withdrawal.ID {
+		t.Errorf("got %d withdrawals, want only %d", len(withdrawals), withdrawal.ID)
+	}
+}
+
+func TestBalanceService_ConcurrentWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	store, repos, userID := newTestStore(t, 100)
+	balanceService := NewBalanceService(repos.Withdrawals, repository.NewMemoryTxManager(store))
+
+	// Every withdrawal fits the balance on its own, only one fits in total
+	const workers = 10
+	numbers := []string{
+		"2377225624", "12345678903", "79927398713", "49927398716", "1234567812345670",
+		"378282246310005", "4111111111111111", "5555555555554444", "6011111111111117", "30569309025904",
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := range workers {
+		wg.Add(1)
+		go func(number string) {
+			defer wg.Done()
+			_, err := balanceService.Withdraw(ctx, userID, number, 60)
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case !errors.Is(err, ErrInsufficientFunds):
+				t.Errorf("withdrawal %s: %v", number, err)
+			}
+		}(numbers[i])
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("%d withdrawals succeeded, want 1", succeeded)
+	}
+	balance, err := balanceService.GetBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Current < 0 {
+		t.Errorf("balance went negative: %v", balance.Current)
+	}
+}
+
+func TestBalanceService_WithdrawRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+	store, repos, userID := newTestStore(t, 100)
+	balanceService := NewBalanceService(repos.Withdrawals, repository.NewMemoryTxManager(store))
+
+	// The outbox event is the audit record of a withdrawal and must only
+	// exist when the withdrawal does
+	if _, err := balanceService.Withdraw(ctx, userID, "12345678903", 500); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("overdraft: got %v, want %v", err, ErrInsufficientFunds)
+	}
+	if _, err := balanceService.Withdraw(ctx, userID, "2377225624", 40); err != nil {
+		t.Fatalf("unexpected withdrawal error: %v", err)
+	}
+
+	events, err := repository.NewMemoryOutboxRepository(store).ClaimBatch(ctx, 100, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimBatch failed: %v", err)
+	}
+	var withdrawals []model.WithdrawalEventPayload
+	for _, event := range events {
+		if event.Type != model.EventWithdrawalMade {
+			continue
+		}
+		var payload model.WithdrawalEventPayload
+		if err := event.Decode(&payload); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		withdrawals = append(withdrawals, payload)
+	}
+	if len(withdrawals) != 1 || withdrawals[0].Order != "2377225624" || withdrawals[0].Sum != 40 {
+		t.Errorf("got withdrawal events %+v, want one for 40 points on 2377225624", withdrawals)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/riouske/gophermart/internal/events"
+	"github.com/riouske/gophermart/internal/model"
+)
+
+// OrderStatusData is the payload of live order status events
+type OrderStatusData struct {
+	Number  string            `json:"number"`
+	Status  model.OrderStatus `json:"status"`
+	Accrual *float64          `json:"accrual,omitempty"`
+}
+
+// LiveNotifier forwards domain events to connected live clients. The
+// outbox hands each event to one instance only, so it is broadcast to the
+// clients connected to the others too.
+type LiveNotifier struct {
+	broadcaster    events.Broadcaster
+	balanceService *BalanceService
+}
+
+func NewLiveNotifier(broadcaster events.Broadcaster, balanceService *BalanceService) *LiveNotifier {
+	return &LiveNotifier{
+		broadcaster:    broadcaster,
+		balanceService: balanceService,
+	}
+}
+
+// HandleEvent is an outbox subscriber pushing order and balance updates
+func (n *LiveNotifier) HandleEvent(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Type {
+	case model.EventOrderStatusChanged:
+		var payload model.OrderEventPayload
+		if err := event.Decode(&payload); err != nil {
+			return fmt.Errorf("failed to decode order event: %w", err)
+		}
+
+		data := OrderStatusData{Number: payload.Number, Status: payload.Status}
+		if payload.Status == model.OrderStatusProcessed {
+			data.Accrual = &payload.Accrual
+		}
+
+		err := n.broadcaster.Broadcast(ctx, events.Event{
+			Type:   events.TypeOrderStatus,
+			UserID: event.UserID,
+			Data:   data,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to broadcast order status: %w", err)
+		}
+	case model.EventOrderProcessed, model.EventWithdrawalMade:
+		balance, err := n.balanceService.GetBalance(ctx, event.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+
+		err = n.broadcaster.Broadcast(ctx, events.Event{
+			Type:   events.TypeBalanceChanged,
+			UserID: event.UserID,
+			Data:   balance,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to broadcast balance: %w", err)
+		}
+	}
+
+	return nil
+}
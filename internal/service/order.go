@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+type OrderService struct {
+	orderRepo *repository.OrderRepository
+	tx        repository.Transactor
+}
+
+func NewOrderService(orderRepo *repository.OrderRepository, tx repository.Transactor) *OrderService {
+	return &OrderService{
+		orderRepo: orderRepo,
+		tx:        tx,
+	}
+}
+
+// ClaimUnprocessed returns orders still waiting for a final accrual status,
+// hiding them from other pollers for the lease
+func (s *OrderService) ClaimUnprocessed(ctx context.Context, limit int, lease time.Duration) ([]*model.Order, error) {
+	return s.orderRepo.ClaimUnprocessed(ctx, limit, lease)
+}
+
+// ApplyAccrual moves an order to the status reported by the accrual system
+// and credits the accrual when it is processed. The order is re-read in the
+// same transaction, so orders that already reached a final status are never
+// credited twice.
+func (s *OrderService) ApplyAccrual(ctx context.Context, orderID int64, status model.OrderStatus, accrual float64) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context, repos *repository.Repositories) error {
+		order, err := repos.Orders.GetByID(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		if order.Status == status || isFinalStatus(order.Status) {
+			return nil
+		}
+
+		if status == model.OrderStatusProcessed {
+			return repos.Orders.UpdateAccrual(ctx, orderID, accrual, status)
+		}
+
+		return repos.Orders.UpdateStatus(ctx, orderID, status)
+	})
+}
+
+func isFinalStatus(status model.OrderStatus) bool {
+	return status == model.OrderStatusInvalid || status == model.OrderStatusProcessed
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("webhook url must be an absolute http(s) url")
+	ErrWebhookURLNotAllowed = errors.New("webhook url must point to a public address")
+	ErrInvalidWebhookEvent  = errors.New("unknown webhook event")
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventHeader     = "X-Gophermart-Event"
+	WebhookDeliveryHeader  = "X-Gophermart-Delivery"
+	WebhookSignatureHeader = "X-Gophermart-Signature"
+)
+
+var webhookEvents = map[model.WebhookEvent]bool{
+	model.WebhookEventOrderProcessed:   true,
+	model.WebhookEventBalanceWithdrawn: true,
+}
+
+type WebhookService struct {
+	webhookRepo *repository.WebhookRepository
+}
+
+func NewWebhookService(webhookRepo *repository.WebhookRepository) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+	}
+}
+
+// Subscribe registers a webhook for the user. A signing secret is generated
+// when none is given. URLs resolving to loopback, private or otherwise
+// internal addresses are refused, so webhooks cannot probe our network.
+func (s *WebhookService) Subscribe(ctx context.Context, userID int64, rawURL, secret string, events []model.WebhookEvent) (*model.Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookURL, err)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrWebhookURLNotAllowed, parsed.Hostname(), addr)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, ErrInvalidWebhookEvent
+	}
+	for _, event := range events {
+		if !webhookEvents[event] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+
+	if secret == "" {
+		secret, err = generateSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := &model.Webhook{
+		UserID: userID,
+		URL:    parsed.String(),
+		Secret: secret,
+		Events: events,
+	}
+
+	if err := s.webhookRepo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID int64) ([]*model.Webhook, error) {
+	return s.webhookRepo.GetByUserID(ctx, userID)
+}
+
+func (s *WebhookService) Unsubscribe(ctx context.Context, userID, webhookID int64) error {
+	return s.webhookRepo.Delete(ctx, userID, webhookID)
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID int64) ([]*model.WebhookDelivery, error) {
+	return s.webhookRepo.GetDeliveries(ctx, userID, 100)
+}
+
+// Replay queues a delivery to be sent again, including dead-lettered ones.
+// Deliveries that may be in flight are refused with ErrDeliveryInFlight.
+func (s *WebhookService) Replay(ctx context.Context, userID, deliveryID int64) error {
+	return s.webhookRepo.Replay(ctx, userID, deliveryID)
+}
+
+// webhookOrderData is the order description sent to merchants
+type webhookOrderData struct {
+	Number  string            `json:"number"`
+	Status  model.OrderStatus `json:"status"`
+	Accrual float64           `json:"accrual"`
+}
+
+// webhookWithdrawalData is the withdrawal description sent to merchants
+type webhookWithdrawalData struct {
+	Order       string    `json:"order"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// HandleEvent is an outbox subscriber queueing deliveries for matching webhooks
+func (s *WebhookService) HandleEvent(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Type {
+	case model.EventOrderProcessed:
+		var payload model.OrderEventPayload
+		if err := event.Decode(&payload); err != nil {
+			return fmt.Errorf("failed to decode order event: %w", err)
+		}
+		data := webhookOrderData{Number: payload.Number, Status: payload.Status, Accrual: payload.Accrual}
+		return s.webhookRepo.EnqueueForEvent(ctx, event.ID, event.UserID, model.WebhookEventOrderProcessed, data)
+	case model.EventWithdrawalMade:
+		var payload model.WithdrawalEventPayload
+		if err := event.Decode(&payload); err != nil {
+			return fmt.Errorf("failed to decode withdrawal event: %w", err)
+		}
+		data := webhookWithdrawalData{Order: payload.Order, Sum: payload.Sum, ProcessedAt: payload.ProcessedAt}
+		return s.webhookRepo.EnqueueForEvent(ctx, event.ID, event.UserID, model.WebhookEventBalanceWithdrawn, data)
+	}
+
+	return nil
+}
+
+// SignWebhookPayload computes the signature header value for a delivery body.
+// Receivers recompute HMAC-SHA256 over "<timestamp>.<body>" with their secret.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// nonPublicPrefixes are special-purpose ranges netip has no predicate for.
+// Cloud providers and carriers put internal services on shared address
+// space, and NAT64 prefixes translate to arbitrary IPv4 addresses.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // this network
+	netip.MustParsePrefix("100.64.0.0/10"),  // shared address space (CGNAT)
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64 well-known prefix
+	netip.MustParsePrefix("64:ff9b:1::/48"), // NAT64 local-use prefix
+}
+
+// isPublicAddr reports whether webhooks may connect to addr
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsUnspecified() ||
+		addr.IsMulticast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublicOnly is a net.Dialer Control refusing internal addresses. It
+// sees the address actually dialled, so hosts re-resolving to an internal
+// address after Subscribe (DNS rebinding) are caught too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrWebhookURLNotAllowed, address)
+	}
+	return nil
+}
+
+// newWebhookHTTPClient returns the client deliveries are sent with. Dials
+// pass through control, and redirects are answered as is instead of being
+// followed, since they could point anywhere.
+func newWebhookHTTPClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect to the endpoint on our behalf, out of reach of control
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// WebhookDispatcher delivers queued webhook events with retries
+type WebhookDispatcher struct {
+	webhookRepo *repository.WebhookRepository
+	httpClient  *http.Client
+	interval    time.Duration
+	retryBase   time.Duration
+	maxAttempts int
+	batchSize   int
+}
+
+func NewWebhookDispatcher(webhookRepo *repository.WebhookRepository, interval, retryBase time.Duration, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhookRepo: webhookRepo,
+		httpClient:  newWebhookHTTPClient(dialPublicOnly),
+		interval:    interval,
+		retryBase:   retryBase,
+		maxAttempts: maxAttempts,
+		batchSize:   50,
+	}
+}
+
+// Run dispatches due deliveries until the context is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch(ctx context.Context) {
+	// Claimed deliveries are hidden from other dispatchers for longer than one HTTP attempt
+	deliveries, err := d.webhookRepo.ClaimDue(ctx, d.batchSize, 2*d.httpClient.Timeout)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		attempts := delivery.Attempts + 1
+		if err := d.deliver(ctx, delivery); err != nil {
+			dead := attempts >= d.maxAttempts
+			if dead {
+				slog.WarnContext(ctx, "Webhook delivery dead-lettered", "delivery_id", delivery.ID, "attempts", attempts, "error", err)
+			}
+			nextAttemptAt := time.Now().Add(d.Backoff(attempts))
+			if err := d.webhookRepo.MarkFailed(ctx, delivery.ID, attempts, nextAttemptAt, err.Error(), dead); err != nil {
+				slog.ErrorContext(ctx, "Failed to record webhook delivery failure", "delivery_id", delivery.ID, "error", err)
+			}
+			continue
+		}
+
+		if err := d.webhookRepo.MarkDelivered(ctx, delivery.ID, attempts); err != nil {
+			slog.ErrorContext(ctx, "Failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+		}
+	}
+}
+
+// Backoff returns the delay before the next attempt, doubling after each failure
+func (d *WebhookDispatcher) Backoff(attempts int) time.Duration {
+	const maxBackoff = 6 * time.Hour
+
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// deliver posts a signed delivery; any non-2xx answer counts as a failure
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(delivery.Secret, time.Now().Unix(), delivery.Payload))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
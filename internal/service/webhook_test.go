@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/repository"
+)
+
+func TestWebhookDispatcher_Backoff(t *testing.T) {
+	dispatcher := NewWebhookDispatcher(nil, time.Second, 10*time.Second, 5)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 4, want: 80 * time.Second},
+		{attempts: 30, want: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := dispatcher.Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDispatcher_Deliver(t *testing.T) {
+	payload := []byte(`{"event":"order.processed","data":{"number":"79927398713"}}`)
+
+	var gotSignature, gotEvent string
+	var gotBody []byte
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(WebhookSignatureHeader)
+		gotEvent = r.Header.Get(WebhookEventHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	dispatcher := NewWebhookDispatcher(nil, time.Second, time.Second, 5)
+	// The test server listens on loopback, which deliveries refuse
+	dispatcher.httpClient = newWebhookHTTPClient(nil)
+	delivery := &model.WebhookDelivery{
+		ID:      7,
+		Event:   model.WebhookEventOrderProcessed,
+		Payload: payload,
+		URL:     server.URL,
+		Secret:  "top-secret",
+	}
+
+	if err := dispatcher.deliver(context.Background(), delivery); err != nil {
+		t.Fatalf("unexpected delivery error: %v", err)
+	}
+
+	if gotEvent != string(model.WebhookEventOrderProcessed) {
+		t.Errorf("unexpected event header: %q", gotEvent)
+	}
+	if string(gotBody) != string(payload) {
+		t.Errorf("unexpected body: %s", gotBody)
+	}
+
+	var timestamp int64
+	var mac string
+	if _, err := fmt.Sscanf(gotSignature, "t=%d,v1=%s", &timestamp, &mac); err != nil {
+		t.Fatalf("malformed signature header %q: %v", gotSignature, err)
+	}
+	if want := SignWebhookPayload("top-secret", timestamp, payload); gotSignature != want {
+		t.Errorf("signature mismatch: got %q want %q", gotSignature, want)
+	}
+
+	status = http.StatusInternalServerError
+	if err := dispatcher.deliver(context.Background(), delivery); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+}
+
+func TestWebhookDispatcher_RefusesInternalAddresses(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	dispatcher := NewWebhookDispatcher(nil, time.Second, time.Second, 5)
+	delivery := &model.WebhookDelivery{
+		ID:      7,
+		Event:   model.WebhookEventOrderProcessed,
+		Payload: []byte(`{}`),
+		URL:     server.URL,
+		Secret:  "top-secret",
+	}
+
+	// Subscribe refuses such URLs, but a public host may resolve to an
+	// internal address by the time it is delivered to
+	if err := dispatcher.deliver(context.Background(), delivery); !errors.Is(err, ErrWebhookURLNotAllowed) {
+		t.Errorf("got %v, want %v", err, ErrWebhookURLNotAllowed)
+	}
+	if requests != 0 {
+		t.Errorf("internal endpoint received %d requests", requests)
+	}
+}
+
+func TestWebhookDispatcher_DoesNotFollowRedirects(t *testing.T) {
+	var redirected int
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected++
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	dispatcher := NewWebhookDispatcher(nil, time.Second, time.Second, 5)
+	dispatcher.httpClient = newWebhookHTTPClient(nil)
+	delivery := &model.WebhookDelivery{
+		ID:      7,
+		Event:   model.WebhookEventOrderProcessed,
+		Payload: []byte(`{}`),
+		URL:     server.URL,
+		Secret:  "top-secret",
+	}
+
+	if err := dispatcher.deliver(context.Background(), delivery); err == nil {
+		t.Error("expected a redirect to count as a failed delivery")
+	}
+	if redirected != 0 {
+		t.Errorf("redirect was followed %d times", redirected)
+	}
+}
+
+func TestWebhookService_SubscribeRejectsInternalURLs(t *testing.T) {
+	// Rejected URLs never reach the repository
+	webhookService := NewWebhookService(repository.NewWebhookRepository(nil, time.Second))
+	events := []model.WebhookEvent{model.WebhookEventOrderProcessed}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{url: "http://127.0.0.1/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://localhost:8080/hook", want: ErrWebhookURLNotAllowed},
+		{url: "https://10.1.2.3/hook", want: ErrWebhookURLNotAllowed},
+		{url: "https://172.16.0.1/hook", want: ErrWebhookURLNotAllowed},
+		{url: "https://192.168.1.1/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://169.254.169.254/latest/meta-data", want: ErrWebhookURLNotAllowed},
+		{url: "http://0.0.0.0/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://224.0.0.1/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://[::1]/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://[fe80::1]/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://[fd00::1]/hook", want: ErrWebhookURLNotAllowed},
+		{url: "http://[::ffff:127.0.0.1]/hook", want: ErrWebhookURLNotAllowed},
+		{url: "ftp://203.0.113.10/hook", want: ErrInvalidWebhookURL},
+		{url: "/hook", want: ErrInvalidWebhookURL},
+		{url: "http://:8080/hook", want: ErrInvalidWebhookURL},
+	}
+
+	for _, tt := range tests {
+		_, err := webhookService.Subscribe(context.Background(), 1, tt.url, "", events)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Subscribe(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "203.0.113.10", want: true},
+		{addr: "8.8.8.8", want: true},
+		{addr: "2001:4860:4860::8888", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "10.0.0.1", want: false},
+		{addr: "169.254.0.1", want: false},
+		{addr: "::", want: false},
+		{addr: "ff02::1", want: false},
+		{addr: "::ffff:192.168.0.1", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "100.127.255.254", want: false},
+		{addr: "100.128.0.1", want: true},
+		{addr: "192.0.0.170", want: false},
+		{addr: "198.18.0.1", want: false},
+		{addr: "198.19.255.255", want: false},
+		{addr: "0.1.2.3", want: false},
+		{addr: "255.255.255.255", want: false},
+		{addr: "::ffff:100.64.0.1", want: false},
+		{addr: "64:ff9b::a9fe:a9fe", want: false},
+		{addr: "64:ff9b:1::a00:1", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
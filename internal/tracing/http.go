@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/riouske/gophermart/internal/logger"
+)
+
+// Mux reports the pattern a request matches, like http.ServeMux and router.Router
+type Mux interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+// Middleware starts a server span for every request passed to next,
+// continuing the caller's trace when a traceparent header is present.
+// Spans are named after the pattern the request matches in mux and the
+// trace ID is added to the request's log lines.
+func Middleware(mux Mux, next http.Handler) http.Handler {
+	withTraceID := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spanContext := trace.SpanContextFromContext(r.Context())
+		if spanContext.IsSampled() {
+			ctx := logger.WithAttrs(r.Context(), slog.String("trace_id", spanContext.TraceID().String()))
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	return otelhttp.NewHandler(withTraceID, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			_, pattern := mux.Handler(r)
+			switch {
+			case pattern == "":
+				return r.Method
+			case strings.Contains(pattern, " "):
+				// Method-aware patterns already read "GET /path"
+				return pattern
+			default:
+				return r.Method + " " + pattern
+			}
+		}),
+	)
+}
+
+// Transport propagates the trace context on outgoing requests and records
+// a client span for each of them
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
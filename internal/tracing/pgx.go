@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxLogger turns the statements pgx v4 reports to its logger into spans.
+// pgx v4 has no tracing hooks, but it logs every Query, Exec, SendBatch and
+// CopyFrom with its duration once the statement finished, so the span is
+// recorded after the fact with the original start time.
+// Set it as ConnConfig.Logger with LogLevel at least pgx.LogLevelInfo.
+type PgxLogger struct{}
+
+func (PgxLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	switch msg {
+	case "Query", "Exec", "SendBatch", "CopyFrom":
+	default:
+		return
+	}
+
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return
+	}
+
+	end := time.Now()
+	elapsed, _ := data["time"].(time.Duration)
+
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if sql, ok := data["sql"].(string); ok {
+		attrs = append(attrs, semconv.DBQueryText(sql))
+	}
+	if rows, ok := data["rowCount"].(int64); ok {
+		attrs = append(attrs, attribute.Int64("db.rows", rows))
+	}
+	if batchLen, ok := data["batchLen"].(int); ok {
+		attrs = append(attrs, attribute.Int("db.batch.size", batchLen))
+	}
+
+	_, span := Tracer().Start(ctx, "pgx."+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-elapsed)),
+		trace.WithAttributes(attrs...),
+	)
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
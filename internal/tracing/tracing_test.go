@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return recorder
+}
+
+func TestMiddleware_PropagatesToOutgoingRequests(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	var traceparent string
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer accrual.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user/orders", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, accrual.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Accrual request failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	})
+
+	// The caller's trace must be continued, not replaced
+	callerTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+	req.Header.Set("traceparent", "00-"+callerTraceID+"-00f067aa0ba902b7-01")
+	Middleware(mux, mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	if traceparent == "" {
+		t.Fatal("Expected a traceparent header on the accrual request")
+	}
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			server = span
+		}
+	}
+	if server == nil {
+		t.Fatal("Expected a server span")
+	}
+	if server.Name() != "GET /api/user/orders" {
+		t.Errorf("Expected span named after the route, got %q", server.Name())
+	}
+	if server.SpanContext().TraceID().String() != callerTraceID {
+		t.Errorf("Expected trace %s to be continued, got %s", callerTraceID, server.SpanContext().TraceID())
+	}
+	if want := "00-" + callerTraceID + "-"; traceparent[:len(want)] != want {
+		t.Errorf("Expected traceparent in trace %s, got %q", callerTraceID, traceparent)
+	}
+}
+
+func TestPgxLogger_RecordsStatementSpans(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	PgxLogger{}.Log(ctx, 0, "Query", map[string]interface{}{
+		"sql":      "SELECT 1",
+		"time":     20 * time.Millisecond,
+		"rowCount": int64(1),
+	})
+	PgxLogger{}.Log(ctx, 0, "Exec", map[string]interface{}{
+		"sql":  "UPDATE orders SET status = $1",
+		"time": time.Millisecond,
+		"err":  errors.New("boom"),
+	})
+	PgxLogger{}.Log(ctx, 0, "closed connection", nil)
+	parent.End()
+
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			spans = append(spans, span)
+		}
+	}
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 statement spans, got %d", len(spans))
+	}
+
+	if spans[0].Name() != "pgx.Query" {
+		t.Errorf("Expected pgx.Query span, got %q", spans[0].Name())
+	}
+	if got := spans[0].EndTime().Sub(spans[0].StartTime()); got != 20*time.Millisecond {
+		t.Errorf("Expected the span to last 20ms, got %s", got)
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("Expected the failed statement to be marked as an error")
+	}
+}
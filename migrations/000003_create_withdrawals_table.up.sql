@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    order_number VARCHAR(255) NOT NULL,
+    sum NUMERIC(10, 2) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT unique_withdrawal_order UNIQUE (order_number)
+);
\ No newline at end of file
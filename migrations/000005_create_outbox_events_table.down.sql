@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS webhook_deliveries_event_idx;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS outbox_event_id;
+DROP TABLE IF EXISTS outbox_events;
\ No newline at end of file
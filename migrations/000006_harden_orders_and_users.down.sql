@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS users_login_lower_idx;
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
+
+DROP INDEX IF EXISTS orders_user_id_uploaded_at_idx;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+-- Back to wall-clock time in gophermart.legacy_time_zone, see the up migration
+ALTER TABLE orders ALTER COLUMN uploaded_at TYPE TIMESTAMP
+    USING uploaded_at AT TIME ZONE COALESCE(NULLIF(current_setting('gophermart.legacy_time_zone', true), ''), 'UTC');
+ALTER SEQUENCE orders_id_seq AS INTEGER;
+ALTER TABLE orders ALTER COLUMN id TYPE INTEGER;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- !!! READ BEFORE MIGRATING A DATABASE WITH EXISTING ORDERS !!!
+--
+-- uploaded_at was a TIMESTAMP without time zone, into which pgx wrote the
+-- wall-clock time of the server process in its local time zone. Converting
+-- it needs that zone, read from the gophermart.legacy_time_zone setting and
+-- defaulting to UTC. When the server did not run in UTC, set it to the zone
+-- it ran in for the migrating session, for example with
+--
+--   PGOPTIONS='-c gophermart.legacy_time_zone=Europe/Moscow' migrate ...
+--
+-- or by adding gophermart.legacy_time_zone=Europe/Moscow to the query of the
+-- DATABASE_URI used to migrate. Otherwise every existing upload time shifts
+-- by the offset of that zone.
+ALTER TABLE orders ALTER COLUMN id TYPE BIGINT;
+ALTER SEQUENCE orders_id_seq AS BIGINT;
+ALTER TABLE orders ALTER COLUMN uploaded_at TYPE TIMESTAMP WITH TIME ZONE
+    USING uploaded_at AT TIME ZONE COALESCE(NULLIF(current_setting('gophermart.legacy_time_zone', true), ''), 'UTC');
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED'));
+
+CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at DESC);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_login_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_idx ON users (LOWER(login));
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Keys reserved before the lease existed count as abandoned
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
@@ -0,0 +1,4 @@
+-- Identifies the reservation holding a key, so that a request whose lease
+-- ran out cannot complete or release a key another request took over.
+-- Keys reserved before have no token and can only be taken over.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS token TEXT NOT NULL DEFAULT '';
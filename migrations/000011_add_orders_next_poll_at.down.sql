@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_unprocessed_next_poll_at_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS next_poll_at;
@@ -0,0 +1,3 @@
+-- Pollers claim unprocessed orders by pushing their next poll out
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_poll_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS orders_unprocessed_next_poll_at_idx ON orders (next_poll_at) WHERE status IN ('NEW', 'PROCESSING');
@@ -1,30 +1,100 @@
 package migrations
 
 import (
+	"context"
+	"database/sql"
+	"embed"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
+//go:embed *.sql
+var files embed.FS
+
+// autoMigrateLockID is the advisory lock key serializing migrations of concurrently starting replicas
+const autoMigrateLockID = 8315024619
+
+// RunMigrations applies all pending migrations. An empty migrationsPath uses
+// the migrations embedded in the binary.
 func RunMigrations(databaseDSN string, migrationsPath string) error {
-	log.Println("Running database migrations...")
+	slog.Info("Running database migrations")
+
+	m, err := NewMigrator(databaseDSN, migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Up(0); err != nil {
+		m.Close()
+		return err
+	}
+
+	if err := m.Close(); err != nil {
+		return err
+	}
+
+	slog.Info("Migrations applied successfully")
+
+	return nil
+}
 
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", migrationsPath),
-		databaseDSN,
-	)
+// AutoMigrate applies the embedded migrations at server start. Replicas
+// starting together wait on an advisory lock instead of racing each other.
+func AutoMigrate(ctx context.Context, db *sql.DB) error {
+	slog.Info("Running database migrations")
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, autoMigrateLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	unlock := func() error {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, autoMigrateLockID)
+		return err
+	}
+
+	src, err := iofs.New(files, ".")
 	if err != nil {
+		unlock()
+		return fmt.Errorf("failed to create migration instance: %w", err)
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		unlock()
+		return fmt.Errorf("failed to create migration instance: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		unlock()
 		return fmt.Errorf("failed to create migration instance: %w", err)
 	}
 
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		unlock()
 		return fmt.Errorf("failed to apply migrations: %w", err)
 	}
 
+	// The lock belongs to the session, so release it before the driver
+	// hands the connection back to the pool
+	if err := unlock(); err != nil {
+		return fmt.Errorf("failed to release migration lock: %w", err)
+	}
+
+	return closeMigrate(m)
+}
+
+func closeMigrate(m *migrate.Migrate) error {
 	srcErr, dbErr := m.Close()
 	if srcErr != nil {
 		return fmt.Errorf("error closing source: %w", srcErr)
@@ -34,7 +104,51 @@ func RunMigrations(databaseDSN string, migrationsPath string) error {
 		return fmt.Errorf("error closing database: %w", dbErr)
 	}
 
-	log.Println("Migrations applied successfully")
+	slog.Info("Migrations applied successfully")
+
+	return nil
+}
+
+// LatestVersion returns the newest migration embedded in the binary
+func LatestVersion() (uint, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	defer src.Close()
+
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, errors.New("no embedded migrations")
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// CheckVersion fails unless the schema is clean and at least at the expected
+// version. A newer schema is accepted: during a rolling deploy the new
+// release migrates while replicas of the old one are still serving, and
+// migrations only ever add to the schema the old release relies on.
+func CheckVersion(ctx context.Context, db *sql.DB, expected uint) error {
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no migrations applied, expected version %d", expected)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+	if version < int64(expected) {
+		return fmt.Errorf("schema is at version %d, expected at least %d", version, expected)
+	}
 
 	return nil
 }
@@ -0,0 +1,184 @@
+package migrations
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/riouske/gophermart/internal/tests"
+)
+
+func TestEmbeddedMigrationsArePaired(t *testing.T) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		t.Fatalf("Failed to list embedded migrations: %v", err)
+	}
+	if len(names) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	embedded := make(map[string]bool, len(names))
+	for _, name := range names {
+		embedded[name] = true
+	}
+
+	for _, name := range names {
+		var pair string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			pair = strings.TrimSuffix(name, ".up.sql") + ".down.sql"
+		case strings.HasSuffix(name, ".down.sql"):
+			pair = strings.TrimSuffix(name, ".down.sql") + ".up.sql"
+		default:
+			t.Errorf("unexpected migration file %s", name)
+			continue
+		}
+		if !embedded[pair] {
+			t.Errorf("migration %s has no matching %s", name, pair)
+		}
+	}
+}
+
+func TestPlanSteps(t *testing.T) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		t.Fatalf("Failed to open embedded migrations: %v", err)
+	}
+	versions, err := sourceVersions(src)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) < 3 {
+		t.Fatalf("expected at least 3 migrations, got %v", versions)
+	}
+	last := int(versions[len(versions)-1])
+
+	tests := []struct {
+		name    string
+		version int
+		target  func(versions []uint, current int) (int, error)
+		want    []uint
+		dir     string
+	}{
+		{
+			name:    "Up from empty schema",
+			version: -1,
+			target:  func(versions []uint, current int) (int, error) { return len(versions) - 1, nil },
+			want:    versions,
+			dir:     "up",
+		},
+		{
+			name:    "Down two steps",
+			version: last,
+			target:  func(versions []uint, current int) (int, error) { return current - 2, nil },
+			want:    []uint{versions[len(versions)-1], versions[len(versions)-2]},
+			dir:     "down",
+		},
+		{
+			name:    "Nothing to do",
+			version: last,
+			target:  func(versions []uint, current int) (int, error) { return current, nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := planSteps(src, tt.version, tt.target)
+			if err != nil {
+				t.Fatalf("planSteps failed: %v", err)
+			}
+			if len(steps) != len(tt.want) {
+				t.Fatalf("got %d steps, want %d", len(steps), len(tt.want))
+			}
+			for i, step := range steps {
+				if step.Version != tt.want[i] || step.Direction != tt.dir || step.SQL == "" {
+					t.Errorf("step %d = %d %s, want %d %s with SQL", i, step.Version, step.Direction, tt.want[i], tt.dir)
+				}
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"000001_init.up.sql", "000001_init.down.sql", "000007_add_index.up.sql", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	upPath, downPath, err := Create(dir, "Add Audit Log")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if filepath.Base(upPath) != "000008_add_audit_log.up.sql" || filepath.Base(downPath) != "000008_add_audit_log.down.sql" {
+		t.Errorf("got %s and %s", upPath, downPath)
+	}
+	for _, path := range []string{upPath, downPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+
+	if _, _, err := Create(dir, " "); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		t.Fatalf("Failed to list embedded migrations: %v", err)
+	}
+
+	var want uint64
+	for _, name := range names {
+		version, err := strconv.ParseUint(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			t.Fatalf("Migration %s has no numeric version", name)
+		}
+		if version > want {
+			want = version
+		}
+	}
+
+	got, err := LatestVersion()
+	if err != nil {
+		t.Fatalf("LatestVersion failed: %v", err)
+	}
+	if uint64(got) != want {
+		t.Errorf("LatestVersion = %d, want %d", got, want)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	ctx := context.Background()
+	db := tests.TestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	if err := AutoMigrate(ctx, db); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatalf("LatestVersion failed: %v", err)
+	}
+
+	if err := CheckVersion(ctx, db, latest); err != nil {
+		t.Errorf("schema at the expected version: %v", err)
+	}
+	// An older release keeps serving on the schema a newer one migrated
+	if err := CheckVersion(ctx, db, latest-1); err != nil {
+		t.Errorf("schema ahead of the expected version: %v", err)
+	}
+	if err := CheckVersion(ctx, db, latest+1); err == nil {
+		t.Error("expected a schema behind the binary to fail the check")
+	}
+}
@@ -0,0 +1,308 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// ErrDirty is returned when a previous migration failed half way.
+// The schema has to be repaired by hand and the version forced.
+var ErrDirty = errors.New("database is in a dirty state")
+
+// Step is one migration file that would be executed
+type Step struct {
+	Version   uint
+	Name      string
+	Direction string
+	SQL       string
+}
+
+// Migrator runs migrations from the embedded files or a directory
+type Migrator struct {
+	m   *migrate.Migrate
+	src source.Driver
+}
+
+// NewMigrator connects to the database. An empty migrationsPath uses the
+// migrations embedded in the binary.
+func NewMigrator(databaseDSN string, migrationsPath string) (*Migrator, error) {
+	var src source.Driver
+	var err error
+	if migrationsPath == "" {
+		src, err = iofs.New(files, ".")
+	} else {
+		src, err = (&file.File{}).Open(fmt.Sprintf("file://%s", migrationsPath))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations source: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("migrations", src, databaseDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration instance: %w", err)
+	}
+
+	return &Migrator{m: m, src: src}, nil
+}
+
+// Version returns the applied version, -1 when no migration ran yet
+func (m *Migrator) Version() (int, bool, error) {
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return -1, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read version: %w", err)
+	}
+	return int(version), dirty, nil
+}
+
+// Up applies the next steps migrations, or all pending ones when steps is 0
+func (m *Migrator) Up(steps int) error {
+	var err error
+	if steps == 0 {
+		err = m.m.Up()
+	} else {
+		err = m.m.Steps(steps)
+	}
+	return ignoreNoChange(err, "apply")
+}
+
+// Down rolls back the last steps migrations
+func (m *Migrator) Down(steps int) error {
+	return ignoreNoChange(m.m.Steps(-steps), "roll back")
+}
+
+// Goto migrates up or down to the given version
+func (m *Migrator) Goto(version uint) error {
+	return ignoreNoChange(m.m.Migrate(version), "migrate")
+}
+
+// Force sets the version without running migrations and clears the dirty flag
+func (m *Migrator) Force(version int) error {
+	if err := m.m.Force(version); err != nil {
+		return fmt.Errorf("failed to force version: %w", err)
+	}
+	return nil
+}
+
+// PlanUp lists the migrations Up would apply
+func (m *Migrator) PlanUp(steps int) ([]Step, error) {
+	return m.plan(func(versions []uint, current int) (int, error) {
+		if steps == 0 || current+steps >= len(versions) {
+			return len(versions) - 1, nil
+		}
+		return current + steps, nil
+	})
+}
+
+// PlanDown lists the migrations Down would roll back
+func (m *Migrator) PlanDown(steps int) ([]Step, error) {
+	return m.plan(func(versions []uint, current int) (int, error) {
+		if current-steps < -1 {
+			return -1, nil
+		}
+		return current - steps, nil
+	})
+}
+
+// PlanGoto lists the migrations Goto would run
+func (m *Migrator) PlanGoto(version uint) ([]Step, error) {
+	return m.plan(func(versions []uint, current int) (int, error) {
+		for i, v := range versions {
+			if v == version {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no migration with version %d", version)
+	})
+}
+
+// Close releases the database connection and the migrations source
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if srcErr != nil {
+		return fmt.Errorf("error closing source: %w", srcErr)
+	}
+
+	if dbErr != nil {
+		return fmt.Errorf("error closing database: %w", dbErr)
+	}
+
+	return nil
+}
+
+// plan resolves the target position with the given function and collects the
+// files between the applied version and the target. Positions index the
+// source versions, -1 standing for an empty schema.
+func (m *Migrator) plan(target func(versions []uint, current int) (int, error)) ([]Step, error) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+
+	return planSteps(m.src, version, target)
+}
+
+func planSteps(src source.Driver, version int, target func(versions []uint, current int) (int, error)) ([]Step, error) {
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	current := -1
+	if version >= 0 {
+		current = indexOf(versions, uint(version))
+		if current < 0 {
+			return nil, fmt.Errorf("applied version %d is missing from the migrations source", version)
+		}
+	}
+
+	to, err := target(versions, current)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	for i := current + 1; i <= to; i++ {
+		step, err := readStep(src, versions[i], "up")
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	for i := current; i > to; i-- {
+		step, err := readStep(src, versions[i], "down")
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func sourceVersions(src source.Driver) ([]uint, error) {
+	version, err := src.First()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	versions := []uint{version}
+	for {
+		version, err = src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		versions = append(versions, version)
+	}
+}
+
+func readStep(src source.Driver, version uint, direction string) (Step, error) {
+	var r io.ReadCloser
+	var name string
+	var err error
+	if direction == "up" {
+		r, name, err = src.ReadUp(version)
+	} else {
+		r, name, err = src.ReadDown(version)
+	}
+	if err != nil {
+		return Step{}, fmt.Errorf("failed to read %s migration %d: %w", direction, version, err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return Step{}, fmt.Errorf("failed to read %s migration %d: %w", direction, version, err)
+	}
+
+	return Step{Version: version, Name: name, Direction: direction, SQL: string(body)}, nil
+}
+
+func indexOf(versions []uint, version uint) int {
+	for i, v := range versions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func ignoreNoChange(err error, action string) error {
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to %s migrations: %w", action, err)
+	}
+	return nil
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+
+// Create scaffolds an empty up/down pair numbered after the newest migration
+// in dir and returns the paths of the new files
+func Create(dir, name string) (string, string, error) {
+	upPath, downPath, err := NextFiles(dir, name)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, path := range []string{upPath, downPath} {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create migration: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return "", "", fmt.Errorf("failed to create migration: %w", err)
+		}
+	}
+
+	return upPath, downPath, nil
+}
+
+// NextFiles returns the paths Create would use
+func NextFiles(dir, name string) (string, string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if name == "" {
+		return "", "", errors.New("migration name is required")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	var last uint64
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err == nil && version > last {
+			last = version
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", last+1, name)
+	return filepath.Join(dir, base+".up.sql"), filepath.Join(dir, base+".down.sql"), nil
+}
@@ -0,0 +1,300 @@
+// Package client is a Go client for the gophermart API, following the
+// OpenAPI contract served at /api/openapi.json. A Client keeps the bearer
+// token issued on Register or Login and sends it with later calls.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusNew        OrderStatus = "NEW"
+	OrderStatusProcessing OrderStatus = "PROCESSING"
+	OrderStatusInvalid    OrderStatus = "INVALID"
+	OrderStatusProcessed  OrderStatus = "PROCESSED"
+)
+
+// Order is an uploaded order. Accrual is zero until it is processed.
+type Order struct {
+	Number     string      `json:"number"`
+	Status     OrderStatus `json:"status"`
+	Accrual    float64     `json:"accrual,omitempty"`
+	UploadedAt time.Time   `json:"uploaded_at"`
+}
+
+type Balance struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+type Withdrawal struct {
+	Order       string    `json:"order"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type withdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+// Client calls the API at a base URL, like "http://localhost:9090". It is
+// safe for concurrent use.
+type Client struct {
+	baseURL         string
+	httpClient      *http.Client
+	compressMinSize int
+
+	mu    sync.RWMutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient instead of
+// http.DefaultClient, for custom timeouts or transports
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken starts the client with a token issued earlier
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRequestCompression gzips request bodies of at least minSize bytes
+func WithRequestCompression(minSize int) Option {
+	return func(c *Client) {
+		c.compressMinSize = minSize
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the bearer token in use, empty before Register or Login
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Register creates a user and logs in as them
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "/api/user/register", login, password)
+}
+
+// Login logs in, replacing the token in use
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "/api/user/login", login, password)
+}
+
+func (c *Client) authenticate(ctx context.Context, path, login, password string) error {
+	body, err := json.Marshal(credentials{Login: login, Password: password})
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, "application/json", body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	token, found := strings.CutPrefix(resp.header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return fmt.Errorf("gophermart: no token in response to %s", path)
+	}
+	c.SetToken(token)
+	return nil
+}
+
+// UploadOrder uploads an order number for accrual. It reports whether the
+// order is new; uploading an order again is not an error.
+func (c *Client) UploadOrder(ctx context.Context, number string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/user/orders", "text/plain", []byte(number),
+		http.StatusOK, http.StatusAccepted)
+	if err != nil {
+		return false, err
+	}
+	return resp.status == http.StatusAccepted, nil
+}
+
+// ListOrders returns the uploaded orders, newest first
+func (c *Client) ListOrders(ctx context.Context) ([]Order, error) {
+	var orders []Order
+	if err := c.getList(ctx, "/api/user/orders", &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Balance returns the points available and spent
+func (c *Client) Balance(ctx context.Context) (*Balance, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/user/balance", "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var balance Balance
+	if err := json.Unmarshal(resp.body, &balance); err != nil {
+		return nil, fmt.Errorf("failed to decode balance: %w", err)
+	}
+	return &balance, nil
+}
+
+// Withdraw spends sum points on the order with the given number
+func (c *Client) Withdraw(ctx context.Context, order string, sum float64) error {
+	body, err := json.Marshal(withdrawRequest{Order: order, Sum: sum})
+	if err != nil {
+		return fmt.Errorf("failed to encode withdrawal: %w", err)
+	}
+	_, err = c.do(ctx, http.MethodPost, "/api/user/balance/withdraw", "application/json", body, http.StatusOK)
+	return err
+}
+
+// Withdrawals returns the withdrawals, newest first
+func (c *Client) Withdrawals(ctx context.Context) ([]Withdrawal, error) {
+	var withdrawals []Withdrawal
+	if err := c.getList(ctx, "/api/user/withdrawals", &withdrawals); err != nil {
+		return nil, err
+	}
+	return withdrawals, nil
+}
+
+// getList decodes a list into v, leaving it empty on 204 No Content
+func (c *Client) getList(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, "", nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	if resp.status == http.StatusNoContent {
+		return nil
+	}
+	if err := json.Unmarshal(resp.body, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request and reads the decompressed response. Statuses other
+// than the expected ones are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, expected ...int) (*response, error) {
+	var contentEncoding string
+	if c.compressMinSize > 0 && len(body) >= c.compressMinSize {
+		compressed, err := gzipBody(body)
+		if err != nil {
+			return nil, err
+		}
+		body, contentEncoding = compressed, "gzip"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	// Asking explicitly turns off the transport's transparent gzip, so
+	// deflate is understood too, whatever the transport
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return &response{status: resp.StatusCode, header: resp.Header, body: respBody}, nil
+		}
+	}
+	return nil, newError(resp, respBody)
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "":
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		zr, err := zlib.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+	return io.ReadAll(reader)
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to compress request: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress request: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,205 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/riouske/gophermart/internal/handler/gophermart/balance"
+	"github.com/riouske/gophermart/internal/handler/gophermart/order"
+	"github.com/riouske/gophermart/internal/handler/gophermart/user"
+	"github.com/riouske/gophermart/internal/handler/middleware"
+	"github.com/riouske/gophermart/internal/model"
+	"github.com/riouske/gophermart/internal/openapi"
+	"github.com/riouske/gophermart/internal/repository"
+	"github.com/riouske/gophermart/internal/router"
+	"github.com/riouske/gophermart/internal/service"
+	"github.com/riouske/gophermart/pkg/client"
+)
+
+// newServer serves the real handlers on in-memory storage, checking that
+// requests follow the contract and compressing every response
+func newServer(t *testing.T) (*httptest.Server, *repository.OrderRepository) {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	orderRepo := repository.NewMemoryOrderRepository(store)
+	withdrawalRepo := repository.NewMemoryWithdrawalRepository(store)
+	authService := service.NewAuthService(repository.NewMemoryUserRepository(store), "test-secret-key")
+	balanceService := service.NewBalanceService(withdrawalRepo, repository.NewMemoryTxManager(store))
+
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := router.New()
+	public := routes.Group("/api/user", middleware.ValidateRequests(validator))
+	public.Post("/register", user.NewRegisterHandler(authService))
+	public.Post("/login", user.NewLoginHandler(authService))
+
+	protected := routes.Group("/api/user", middleware.Auth(authService), middleware.ValidateRequests(validator))
+	protected.Post("/orders", order.NewCreateHandler(orderRepo))
+	protected.Get("/orders", order.NewIndexHandler(orderRepo))
+	protected.Get("/balance", balance.NewShowHandler(balanceService))
+	protected.Post("/balance/withdraw", balance.NewWithdrawHandler(balanceService))
+	protected.Get("/withdrawals", balance.NewWithdrawalsHandler(balanceService))
+
+	server := httptest.NewServer(middleware.Compress(1, 1<<20)(routes))
+	t.Cleanup(server.Close)
+	return server, orderRepo
+}
+
+// encodingRecorder remembers the encodings of the responses received
+type encodingRecorder struct {
+	mu        sync.Mutex
+	encodings map[string]bool
+}
+
+func (r *encodingRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		r.mu.Lock()
+		r.encodings[resp.Header.Get("Content-Encoding")] = true
+		r.mu.Unlock()
+	}
+	return resp, err
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server, orderRepo := newServer(t)
+
+	transport := &encodingRecorder{encodings: make(map[string]bool)}
+	c := client.New(server.URL,
+		client.WithHTTPClient(&http.Client{Transport: transport}),
+		client.WithRequestCompression(1))
+
+	t.Run("Unauthenticated calls fail", func(t *testing.T) {
+		_, err := c.Balance(ctx)
+		if !errors.Is(err, client.ErrUnauthorized) {
+			t.Fatalf("Expected ErrUnauthorized, got %v", err)
+		}
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != "unauthorized" || apiErr.Title == "" {
+			t.Errorf("Expected the problem details, got %+v", apiErr)
+		}
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		if err := c.Register(ctx, "client", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if c.Token() == "" {
+			t.Fatal("Expected the token to be kept")
+		}
+		err := c.Register(ctx, "client", "secret")
+		if !errors.Is(err, client.ErrLoginTaken) || !errors.Is(err, client.ErrConflict) {
+			t.Errorf("Expected ErrLoginTaken, got %v", err)
+		}
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		other := client.New(server.URL)
+		err := other.Login(ctx, "client", "wrong")
+		if !errors.Is(err, client.ErrInvalidCredentials) || !errors.Is(err, client.ErrUnauthorized) {
+			t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+		}
+		if err := other.Login(ctx, "client", "secret"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Orders", func(t *testing.T) {
+		orders, err := c.ListOrders(ctx)
+		if err != nil || len(orders) != 0 {
+			t.Fatalf("Expected no orders, got %v, %v", orders, err)
+		}
+
+		if created, err := c.UploadOrder(ctx, "12345678903"); err != nil || !created {
+			t.Fatalf("Expected a new order, got %v, %v", created, err)
+		}
+		if created, err := c.UploadOrder(ctx, "12345678903"); err != nil || created {
+			t.Fatalf("Expected the order to exist, got %v, %v", created, err)
+		}
+		if _, err := c.UploadOrder(ctx, "12345678901"); !errors.Is(err, client.ErrInvalidOrderNumber) {
+			t.Errorf("Expected ErrInvalidOrderNumber, got %v", err)
+		}
+
+		other := client.New(server.URL)
+		if err := other.Register(ctx, "other", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.UploadOrder(ctx, "12345678903"); !errors.Is(err, client.ErrOrderOwnedByAnotherUser) {
+			t.Errorf("Expected ErrOrderOwnedByAnotherUser, got %v", err)
+		}
+
+		orders, err = c.ListOrders(ctx)
+		if err != nil || len(orders) != 1 {
+			t.Fatalf("Expected one order, got %v, %v", orders, err)
+		}
+		if orders[0].Number != "12345678903" || orders[0].Status != client.OrderStatusNew || orders[0].UploadedAt.IsZero() {
+			t.Errorf("Unexpected order %+v", orders[0])
+		}
+	})
+
+	t.Run("Withdrawals", func(t *testing.T) {
+		if err := c.Withdraw(ctx, "2377225624", 100); !errors.Is(err, client.ErrInsufficientFunds) {
+			t.Fatalf("Expected ErrInsufficientFunds, got %v", err)
+		}
+
+		// Let the accrual system process the order
+		uploaded, err := orderRepo.GetByNumber(ctx, "12345678903")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := orderRepo.UpdateAccrual(ctx, uploaded.ID, 500, model.OrderStatusProcessed); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Withdraw(ctx, "2377225624", 100); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Withdraw(ctx, "2377225624", 100); !errors.Is(err, client.ErrWithdrawalExists) {
+			t.Errorf("Expected ErrWithdrawalExists, got %v", err)
+		}
+
+		b, err := c.Balance(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Current != 400 || b.Withdrawn != 100 {
+			t.Errorf("Expected 400 left of 500, got %+v", b)
+		}
+
+		withdrawals, err := c.Withdrawals(ctx)
+		if err != nil || len(withdrawals) != 1 {
+			t.Fatalf("Expected one withdrawal, got %v, %v", withdrawals, err)
+		}
+		if withdrawals[0].Order != "2377225624" || withdrawals[0].Sum != 100 {
+			t.Errorf("Unexpected withdrawal %+v", withdrawals[0])
+		}
+	})
+
+	if !transport.encodings["gzip"] {
+		t.Error("Expected compressed responses")
+	}
+}
+
+func TestError(t *testing.T) {
+	err := error(&client.Error{StatusCode: http.StatusBadGateway})
+	if !errors.Is(err, client.ErrServer) || errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected only ErrServer to match %v", err)
+	}
+
+	err = &client.Error{StatusCode: http.StatusUnprocessableEntity, Code: "withdrawal_exists", Detail: "withdrawal already exists"}
+	if !errors.Is(err, client.ErrUnprocessable) || !errors.Is(err, client.ErrWithdrawalExists) || errors.Is(err, client.ErrInvalidOrderNumber) {
+		t.Errorf("Unexpected matches for %v", err)
+	}
+	if want := "gophermart: 422 Unprocessable Entity (withdrawal_exists): withdrawal already exists"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors by status, matching any *Error with that status
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrConflict        = errors.New("conflict")
+	ErrUnprocessable   = errors.New("unprocessable request")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServer          = errors.New("server error")
+)
+
+// Errors by problem code, for statuses the API uses for several causes
+var (
+	ErrInvalidCredentials      = errors.New("invalid login or password")
+	ErrLoginTaken              = errors.New("login is taken")
+	ErrOrderOwnedByAnotherUser = errors.New("order was uploaded by another user")
+	ErrInvalidOrderNumber      = errors.New("invalid order number")
+	ErrInsufficientFunds       = errors.New("insufficient funds")
+	ErrWithdrawalExists        = errors.New("points were already withdrawn for the order")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusPaymentRequired:     ErrInsufficientFunds,
+	http.StatusConflict:            ErrConflict,
+	http.StatusUnprocessableEntity: ErrUnprocessable,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
+}
+
+var codeErrors = map[string]error{
+	"invalid_credentials":           ErrInvalidCredentials,
+	"login_taken":                   ErrLoginTaken,
+	"order_exists_for_another_user": ErrOrderOwnedByAnotherUser,
+	"invalid_order_number":          ErrInvalidOrderNumber,
+	"insufficient_funds":            ErrInsufficientFunds,
+	"withdrawal_exists":             ErrWithdrawalExists,
+}
+
+// Error is an error response, decoded from its problem document. Match it
+// with errors.Is against the Err values, or read Code for the others.
+type Error struct {
+	StatusCode int
+	// Code is the stable problem code, like "insufficient_funds"
+	Code      string
+	Title     string
+	Detail    string
+	RequestID string
+	// RetryAfter is how long a rate limited client should wait
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("gophermart: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	if e.StatusCode >= http.StatusInternalServerError && target == ErrServer {
+		return true
+	}
+	if err, ok := statusErrors[e.StatusCode]; ok && err == target {
+		return true
+	}
+	err, ok := codeErrors[e.Code]
+	return ok && err == target
+}
+
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+
+	// Errors are problem documents, but a proxy in front may answer in kind
+	var problem struct {
+		Title     string `json:"title"`
+		Detail    string `json:"detail"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(body, &problem) == nil {
+		e.Code, e.Title, e.Detail, e.RequestID = problem.Code, problem.Title, problem.Detail, problem.RequestID
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}